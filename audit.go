@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An auditLog receives the -syslog start & completion messages of an export, *syslog.Writer
+// implements it
+type auditLog interface {
+	Info(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// auditMessage formats an audit event as its name followed by key="value" pairs in the
+// order given, so messages are easy to parse and search. Values are Go quoted.
+func auditMessage(event string, pairs ...interface{}) string {
+	var b strings.Builder
+	b.WriteString("mycsv " + event)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		switch v := pairs[i+1].(type) {
+		case string:
+			fmt.Fprintf(&b, " %s=%q", pairs[i], v)
+		default:
+			fmt.Fprintf(&b, " %s=%v", pairs[i], v)
+		}
+	}
+
+	return b.String()
+}
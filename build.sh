@@ -19,7 +19,7 @@ echo
 echo
 echo "Building Linux"
 mkdir -p bin/linux
-GOOS=linux GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/linux/mycsv mycsv.go csv_writer.go reset_unix.go
+GOOS=linux GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/linux/mycsv mycsv.go csv_writer.go sql_writer.go table_writer.go html_writer.go lenprefix_writer.go transform.go logger.go output.go query.go wkt.go verify.go throttle.go compress.go schema.go rotate.go diff.go sqlldr.go sort.go socks.go tlspin.go tlsconfig.go raw_writer.go explode_writer.go connector.go profile.go typecheck.go unpivot.go coalesce.go bundle.go postgres.go manifest.go config.go report.go audit.go reset_unix.go syslog_unix.go
 if [[ $? -eq 0 ]]; then
 	echo "	mycsv - OK"
 else
@@ -30,7 +30,7 @@ fi
 echo
 echo "Building Windows"
 mkdir -p bin/windows
-GOOS=windows GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/windows/mycsv.exe mycsv.go csv_writer.go reset_win.go
+GOOS=windows GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/windows/mycsv.exe mycsv.go csv_writer.go sql_writer.go table_writer.go html_writer.go lenprefix_writer.go transform.go logger.go output.go query.go wkt.go verify.go throttle.go compress.go schema.go rotate.go diff.go sqlldr.go sort.go socks.go tlspin.go tlsconfig.go raw_writer.go explode_writer.go connector.go profile.go typecheck.go unpivot.go coalesce.go bundle.go postgres.go manifest.go config.go report.go audit.go reset_win.go syslog_win.go
 if [[ $? -eq 0 ]]; then
 	echo "	mycsv.exe - OK"
 else
@@ -41,7 +41,7 @@ fi
 echo
 echo "Building Darwin"
 mkdir -p bin/darwin
-GOOS=darwin GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/darwin/mycsv mycsv.go csv_writer.go reset_unix.go
+GOOS=darwin GOARCH=amd64 go build -ldflags "-X main.versionInformation=$version" -o bin/darwin/mycsv mycsv.go csv_writer.go sql_writer.go table_writer.go html_writer.go lenprefix_writer.go transform.go logger.go output.go query.go wkt.go verify.go throttle.go compress.go schema.go rotate.go diff.go sqlldr.go sort.go socks.go tlspin.go tlsconfig.go raw_writer.go explode_writer.go connector.go profile.go typecheck.go unpivot.go coalesce.go bundle.go postgres.go manifest.go config.go report.go audit.go reset_unix.go syslog_unix.go
 if [[ $? -eq 0 ]]; then
 	echo "	mycsv - OK"
 else
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A bundleFile is a single member of a -bundle archive, read from path or taken from data
+type bundleFile struct {
+	name string
+	path string
+	data []byte
+}
+
+// A bundleStage is a -bundle archive being written, its members are staged in dir
+type bundleStage struct {
+	out io.WriteCloser
+	dir string
+}
+
+// stageBundle creates the archive name and the temporary directory its members are staged in.
+// The directory is removed by runCleanups.
+func stageBundle(name string) (*bundleStage, error) {
+	out, err := createOutput(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "mycsv-bundle-")
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	atExit(func() { os.RemoveAll(dir) })
+
+	return &bundleStage{out: out, dir: dir}, nil
+}
+
+// writeBundle writes files to w as a zip archive if name ends in .zip, otherwise as a
+// gzip compressed tar archive. Members are given modTime so archives are reproducible.
+func writeBundle(w io.Writer, name string, modTime time.Time, files []bundleFile) error {
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		return writeZipBundle(w, modTime, files)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		r, size, err := file.open()
+		if err != nil {
+			return err
+		}
+
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, r)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeZipBundle writes files to w as a deflate compressed zip archive
+func writeZipBundle(w io.Writer, modTime time.Time, files []bundleFile) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		r, _, err := file.open()
+		if err != nil {
+			return err
+		}
+
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modTime})
+		if err == nil {
+			_, err = io.Copy(fw, r)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// open returns a reader for the member's contents and its size
+func (f bundleFile) open() (io.ReadCloser, int64, error) {
+	if f.path == "" {
+		return ioutil.NopCloser(bytes.NewReader(f.data)), int64(len(f.data)), nil
+	}
+
+	r, err := os.Open(f.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := r.Stat()
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+
+	return r, info.Size(), nil
+}
+
+// bundleFiles lists the members of a bundle staged in dir, files that were not written are skipped
+func bundleFiles(dir string, query string) []bundleFile {
+	files := []bundleFile{{name: "query.sql", data: []byte(strings.TrimSpace(query) + "\n")}}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, name := range names {
+		files = append(files, bundleFile{name: filepath.Base(name), path: name})
+	}
+
+	return files
+}
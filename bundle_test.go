@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteBundle(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.csv"), []byte("\"a\"\n\"1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := bundleFiles(dir, "select 1 as a\n")
+	want := map[string]string{"query.sql": "select 1 as a\n", "data.csv": "\"a\"\n\"1\"\n"}
+	modTime := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// tar.gz
+	b := &bytes.Buffer{}
+	if err := writeBundle(b, "out.tar.gz", modTime, files); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	gz, err := gzip.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(tr)
+		got[h.Name] = string(data)
+		if !h.ModTime.Equal(modTime) {
+			t.Errorf("%s ModTime=%s want %s", h.Name, h.ModTime, modTime)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tar got=%q want=%q", got, want)
+	}
+
+	// zip
+	b.Reset()
+	if err := writeBundle(b, "out.ZIP", modTime, files); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make(map[string]string)
+	for _, f := range zr.File {
+		r, _ := f.Open()
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		got[f.Name] = string(data)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("zip got=%q want=%q", got, want)
+	}
+}
+
+func TestStageBundle(t *testing.T) {
+	staging := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "out.tar.gz")
+	t.Setenv("TMPDIR", staging)
+	db := newStubDB(map[string]stubResult{
+		"select 0": {cols: []string{"ok"}, rows: [][]driver.Value{{[]byte("0")}}},
+		"select 1": {cols: []string{"ok"}, rows: [][]driver.Value{{[]byte("1")}}},
+	})
+	defer db.Close()
+
+	// main only stages the bundle once preflight passes
+	if _, err := preflight(db, "select 1", "select 0", false); err == nil {
+		t.Fatal("Expected the precheck to fail")
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("archive exists after a failed precheck: %v", err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(staging, "*")); len(names) != 0 {
+		t.Errorf("staged after a failed precheck: %q", names)
+	}
+
+	if _, err := preflight(db, "select 1", "select 1", false); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	bundle, err := stageBundle(archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	bundle.out.Close()
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("archive not created: %s", err)
+	}
+	if filepath.Dir(bundle.dir) != staging {
+		t.Errorf("staging dir=%q want one in %q", bundle.dir, staging)
+	}
+
+	runCleanups()
+	if _, err := os.Stat(bundle.dir); !os.IsNotExist(err) {
+		t.Errorf("staging dir not removed: %v", err)
+	}
+}
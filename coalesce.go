@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// A coalescer appends a column holding the first non NULL value of its source columns to
+// each record, like COALESCE(a, b, c). The source columns can be dropped from the output.
+type coalescer struct {
+	name    sql.RawBytes
+	sources []int
+	keep    []int
+	out     []sql.RawBytes
+}
+
+// parseCoalesce splits a -coalesce value such as phone=mobile,home,work into the new column's
+// name and its source column names
+func parseCoalesce(spec string) (string, []string, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return "", nil, fmt.Errorf("-coalesce %q is not column=source1,source2", spec)
+	}
+
+	sources := splitList(kv[1])
+	if len(sources) < 2 {
+		return "", nil, fmt.Errorf("-coalesce requires at least two source columns")
+	}
+
+	return strings.TrimSpace(kv[0]), sources, nil
+}
+
+// newCoalescer resolves the source column names against the query's columns. The new column
+// can not share a name with a column that is written.
+func newCoalescer(cols []sql.RawBytes, name string, sources []string, drop bool, caseSensitive bool) (*coalescer, error) {
+	c := &coalescer{name: []byte(name)}
+	used := make(map[int]bool)
+	for _, source := range sources {
+		found := false
+		for i, col := range cols {
+			if columnMatch(string(col), source, caseSensitive) {
+				if used[i] {
+					return nil, fmt.Errorf("-coalesce column %s is listed more than once", source)
+				}
+				used[i] = true
+				c.sources = append(c.sources, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("-coalesce column %s is not in the query results", source)
+		}
+	}
+
+	for i, col := range cols {
+		if drop && used[i] {
+			continue
+		}
+		if columnMatch(string(col), name, caseSensitive) {
+			return nil, fmt.Errorf("-coalesce column %s is already in the query results", name)
+		}
+		c.keep = append(c.keep, i)
+	}
+	c.out = make([]sql.RawBytes, len(c.keep)+1)
+
+	return c, nil
+}
+
+// header returns the column names with the new column last
+func (c *coalescer) header(cols []sql.RawBytes) []sql.RawBytes {
+	header := make([]sql.RawBytes, 0, len(c.keep)+1)
+	for _, k := range c.keep {
+		header = append(header, cols[k])
+	}
+
+	return append(header, c.name)
+}
+
+// columns returns the column descriptions with the new column last. It has the sources' type
+// when they all share one, otherwise it is TEXT.
+func (c *coalescer) columns(columns []column) []column {
+	out := make([]column, 0, len(c.keep)+1)
+	for _, k := range c.keep {
+		out = append(out, columns[k])
+	}
+
+	col := column{name: string(c.name), dbType: columns[c.sources[0]].dbType}
+	for _, s := range c.sources {
+		if columns[s].dbType != col.dbType {
+			col.dbType = "TEXT"
+		}
+	}
+
+	return append(out, col)
+}
+
+// record returns data with the first non NULL source value appended, NULL when every source
+// is NULL. The returned slice is reused by the next call.
+func (c *coalescer) record(data []sql.RawBytes) []sql.RawBytes {
+	for i, k := range c.keep {
+		c.out[i] = data[k]
+	}
+
+	var value sql.RawBytes
+	for _, s := range c.sources {
+		if data[s] != nil {
+			value = data[s]
+			break
+		}
+	}
+	c.out[len(c.keep)] = value
+
+	return c.out
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestParseCoalesce(t *testing.T) {
+	name, sources, err := parseCoalesce("phone=mobile, home,work")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if name != "phone" || !reflect.DeepEqual(sources, []string{"mobile", "home", "work"}) {
+		t.Errorf("got name=%q sources=%q", name, sources)
+	}
+
+	for _, spec := range []string{"phone", "=a,b", "phone=mobile"} {
+		if _, _, err := parseCoalesce(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	cols := []sql.RawBytes{[]byte("id"), []byte("Mobile"), []byte("home")}
+	c, err := newCoalescer(cols, "phone", []string{"mobile", "home"}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := []sql.RawBytes{[]byte("id"), []byte("Mobile"), []byte("home"), []byte("phone")}
+	if got := c.header(cols); !reflect.DeepEqual(got, want) {
+		t.Errorf("header got=%q want=%q", got, want)
+	}
+
+	data := []sql.RawBytes{[]byte("1"), nil, []byte("555")}
+	want = []sql.RawBytes{[]byte("1"), nil, []byte("555"), []byte("555")}
+	if got := c.record(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("record got=%q want=%q", got, want)
+	}
+
+	// Empty strings are not NULL
+	data = []sql.RawBytes{[]byte("2"), []byte(""), []byte("555")}
+	if got := c.record(data); got[3] == nil || len(got[3]) != 0 {
+		t.Errorf("got=%q want an empty value", got[3])
+	}
+
+	c, err = newCoalescer(cols, "home", []string{"mobile", "home"}, true, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	want = []sql.RawBytes{[]byte("1"), nil}
+	if got := c.record([]sql.RawBytes{[]byte("1"), nil, nil}); !reflect.DeepEqual(got, want) {
+		t.Errorf("dropped record got=%q want=%q", got, want)
+	}
+
+	got := c.columns([]column{{name: "id", dbType: "INT"}, {name: "Mobile", dbType: "VARCHAR"}, {name: "home", dbType: "CHAR"}})
+	if len(got) != 2 || got[1] != (column{name: "home", dbType: "TEXT"}) {
+		t.Errorf("columns got=%+v", got)
+	}
+
+	if _, err := newCoalescer(cols, "id", []string{"mobile", "home"}, false, false); err == nil {
+		t.Error("expected an error for a name already in use")
+	}
+	if _, err := newCoalescer(cols, "phone", []string{"mobile", "work"}, false, false); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// compressOutput wraps an output destination with the compression selected by -compress.
+// Closing the returned io.WriteCloser finishes the compressed stream and closes w.
+func compressOutput(w io.WriteCloser, name string, kind string) (io.WriteCloser, error) {
+	switch kind {
+	case "none":
+		return w, nil
+	case "gzip":
+		return &gzipOutput{Writer: gzip.NewWriter(w), w: w}, nil
+	case "bgzip":
+		index, err := createOutput(name + ".gzi")
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+
+		return newBGZFWriter(w, index), nil
+	default:
+		return nil, fmt.Errorf("Unknown compression %s", kind)
+	}
+}
+
+// A gzipOutput gzip compresses everything written to it into w
+type gzipOutput struct {
+	*gzip.Writer
+	w io.WriteCloser
+}
+
+// Close writes the gzip trailer and closes w
+func (z *gzipOutput) Close() error {
+	err := z.Writer.Close()
+	if cerr := z.w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+const (
+	bgzfBlockSize  = 0xff00 // Uncompressed bytes per block, matches bgzip
+	bgzfHeaderSize = 18
+	bgzfFooterSize = 8
+)
+
+// bgzfEOF is the empty block that marks the end of a BGZF stream
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00,
+	0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// A bgzfWriter writes a blocked gzip stream compatible with bgzip. Every block is an
+// independent gzip member so readers can seek to any block start, the compressed and
+// uncompressed block offsets are written to a .gzi index when the stream is closed.
+type bgzfWriter struct {
+	w       io.WriteCloser
+	index   io.WriteCloser
+	block   []byte
+	buf     bytes.Buffer
+	flate   *flate.Writer
+	coffset uint64
+	uoffset uint64
+	offsets [][2]uint64
+}
+
+// newBGZFWriter returns a bgzfWriter that writes blocks to w and the index to index
+func newBGZFWriter(w io.WriteCloser, index io.WriteCloser) *bgzfWriter {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+
+	return &bgzfWriter{
+		w:     w,
+		index: index,
+		block: make([]byte, 0, bgzfBlockSize),
+		flate: fw,
+	}
+}
+
+// Write buffers p, writing a compressed block each time a full block is collected
+func (z *bgzfWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		c := copy(z.block[len(z.block):cap(z.block)], p)
+		z.block = z.block[:len(z.block)+c]
+		p = p[c:]
+		n += c
+
+		if len(z.block) == cap(z.block) {
+			if err := z.writeBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the final block & EOF marker, then writes the index and closes both outputs
+func (z *bgzfWriter) Close() error {
+	err := z.writeBlock()
+	if err == nil {
+		_, err = z.w.Write(bgzfEOF)
+	}
+	if cerr := z.w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = z.writeIndex()
+	}
+	if cerr := z.index.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// writeBlock compresses the buffered data as a single gzip member with a BC extra field
+func (z *bgzfWriter) writeBlock() error {
+	if len(z.block) == 0 {
+		return nil
+	}
+
+	// The first block is always at offset 0 so the index only lists those after it
+	if z.uoffset > 0 {
+		z.offsets = append(z.offsets, [2]uint64{z.coffset, z.uoffset})
+	}
+
+	z.buf.Reset()
+	z.buf.Write(make([]byte, bgzfHeaderSize))
+	z.flate.Reset(&z.buf)
+	if _, err := z.flate.Write(z.block); err != nil {
+		return err
+	}
+	if err := z.flate.Close(); err != nil {
+		return err
+	}
+
+	var footer [bgzfFooterSize]byte
+	binary.LittleEndian.PutUint32(footer[0:], crc32.ChecksumIEEE(z.block))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(len(z.block)))
+	z.buf.Write(footer[:])
+
+	b := z.buf.Bytes()
+	copy(b, []byte{0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00})
+	binary.LittleEndian.PutUint16(b[16:], uint16(len(b)-1))
+
+	if _, err := z.w.Write(b); err != nil {
+		return err
+	}
+
+	z.coffset += uint64(len(b))
+	z.uoffset += uint64(len(z.block))
+	z.block = z.block[:0]
+
+	return nil
+}
+
+// writeIndex writes the block offsets in the bgzip .gzi format, a little endian entry count
+// followed by compressed & uncompressed offset pairs
+func (z *bgzfWriter) writeIndex() error {
+	b := make([]byte, 8+16*len(z.offsets))
+	binary.LittleEndian.PutUint64(b, uint64(len(z.offsets)))
+	for i, o := range z.offsets {
+		binary.LittleEndian.PutUint64(b[8+16*i:], o[0])
+		binary.LittleEndian.PutUint64(b[16+16*i:], o[1])
+	}
+
+	_, err := z.index.Write(b)
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// closeBuffer is a bytes.Buffer that satisfies io.WriteCloser
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestBGZFWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("1,\"abc\",\\N\n"), 20000)
+
+	out := &closeBuffer{}
+	index := &closeBuffer{}
+	z := newBGZFWriter(out, index)
+	if _, err := z.Write(data); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if !out.closed || !index.closed {
+		t.Errorf("outputs were not closed")
+	}
+
+	// Every block is a gzip member so the whole stream reads as a multistream gzip file
+	r, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("decompressed %d bytes, want %d", len(got), len(data))
+	}
+	if !bytes.HasSuffix(out.Bytes(), bgzfEOF) {
+		t.Errorf("stream does not end with the BGZF EOF block")
+	}
+
+	// The index lists every block after the first
+	idx := index.Bytes()
+	entries := binary.LittleEndian.Uint64(idx)
+	want := uint64((len(data) - 1) / bgzfBlockSize)
+	if entries != want || len(idx) != 8+16*int(entries) {
+		t.Fatalf("index has %d entries in %d bytes, want %d entries", entries, len(idx), want)
+	}
+
+	// Each indexed offset must be a block that decompresses to the data at that position
+	for i := 0; i < int(entries); i++ {
+		coffset := binary.LittleEndian.Uint64(idx[8+16*i:])
+		uoffset := binary.LittleEndian.Uint64(idx[16+16*i:])
+
+		r, err := gzip.NewReader(bytes.NewReader(out.Bytes()[coffset:]))
+		if err != nil {
+			t.Fatalf("#%d: Unexpected error: %s\n", i, err)
+		}
+		r.Multistream(false)
+		block, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("#%d: Unexpected error: %s\n", i, err)
+		}
+		if !bytes.HasPrefix(data[uoffset:], block) {
+			t.Errorf("#%d: block at %d does not match data at %d", i, coffset, uoffset)
+		}
+	}
+}
+
+func TestGzipOutput(t *testing.T) {
+	out := &closeBuffer{}
+	w, err := compressOutput(out, "out.csv.gz", "gzip")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	w.Write([]byte("a,b\n1,2\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if !out.closed {
+		t.Error("output was not closed")
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || string(got) != "a,b\n1,2\n" {
+		t.Errorf("got=%q err=%v", got, err)
+	}
+}
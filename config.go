@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maskedFlags are flags whose values writeConfig does not reveal
+var maskedFlags = map[string]bool{"pass": true}
+
+// actionFlags are flags that do not configure an export, writeConfig leaves them out
+var actionFlags = map[string]bool{"config": true, "dump-config": true, "help": true, "h": true, "version": true}
+
+// readConfig parses key=value lines from a config file. Keys are flag names with or without
+// leading dashes, blank lines and lines starting with # are ignored and values may be quoted.
+// Double quoted values are unquoted as Go strings when they are valid ones, so "\n" is a
+// newline. A key may be repeated, its values are returned in the order given.
+func readConfig(r io.Reader) (map[string][]string, error) {
+	settings := make(map[string][]string)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("line %d is not key=value", n)
+		}
+
+		key := strings.TrimLeft(strings.TrimSpace(line[:i]), "-")
+		value := strings.TrimSpace(line[i+1:])
+		if unquoted, err := strconv.Unquote(value); err == nil && value[0] == '"' {
+			value = unquoted
+		} else if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		settings[key] = append(settings[key], value)
+	}
+
+	return settings, scanner.Err()
+}
+
+// applyConfig sets each flag named in the config file that was not given on the command line
+func applyConfig(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	settings, err := readConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	// Command line flags take precedence over the config file
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// Repeatable flags collect every value, other flags keep the last
+	for key, values := range settings {
+		if key == "config" || flag.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown flag %s", name, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		for _, value := range values {
+			if err := flag.Set(key, value); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %s", name, value, key, err)
+			}
+		}
+	}
+
+	// Anyone who can read the file can read the password
+	if pass := settings["pass"]; len(pass) > 0 && pass[len(pass)-1] != "" {
+		if info, err := f.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+			logger.Printf("Warning: %s contains a password and can be read by other users, use -pass-fd or restrict the file permissions\n", name)
+		}
+	}
+
+	return nil
+}
+
+// writeConfig writes the flags of fs as key=value lines in the format readConfig reads,
+// sorted by name. Secret values are masked. Values with control characters such as the
+// default terminator, and values that readConfig would trim or unquote, are written as a Go
+// quoted string so each setting stays on one line. Repeatable flags get a line per value.
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if actionFlags[f.Name] {
+			return
+		}
+
+		values := []string{f.Value.String()}
+		if l, ok := f.Value.(*listFlag); ok {
+			values = *l
+		}
+		for _, value := range values {
+			if maskedFlags[f.Name] && value != "" {
+				value = "********"
+			}
+			if strings.IndexFunc(value, unicode.IsControl) >= 0 || value != strings.TrimSpace(value) || strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+				value = strconv.Quote(value)
+			}
+
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s=%s\n", f.Name, value)
+			}
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	config := `
+# Nightly export
+user = jprunier
+-host=db1
+--d="|"
+q=''
+query = select * from t where a = 'b'
+t="\r\n"
+e="\"
+null-if=a
+null-if=b
+`
+	got, err := readConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := map[string][]string{"user": {"jprunier"}, "host": {"db1"}, "d": {"|"}, "q": {""}, "query": {"select * from t where a = 'b'"}, "t": {"\r\n"}, "e": {`\`}, "null-if": {"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v want=%v", got, want)
+	}
+
+	_, err = readConfig(strings.NewReader("user jprunier"))
+	if err == nil {
+		t.Error("Error should not be nil")
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	fs := flag.NewFlagSet("mycsv", flag.ContinueOnError)
+	fs.String("user", "", "")
+	fs.String("pass", "", "")
+	fs.String("d", ",", "")
+	fs.String("t", "\n", "")
+	fs.String("q", `"`, "")
+	fs.Bool("help", false, "")
+	var nulls, pads listFlag
+	fs.Var(&nulls, "null-if", "")
+	fs.Var(&pads, "pad", "")
+	fs.Parse([]string{"-pass=secret", "-user=jprunier", "-d= ", "-null-if=a", "-null-if=b,c"})
+
+	b := &bytes.Buffer{}
+	if err := writeConfig(b, fs); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := "d=\" \"\nnull-if=a\nnull-if=b,c\npass=********\nq=\"\\\"\"\nt=\"\\n\"\nuser=jprunier\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+
+	// The output reads back to the same values, apart from the masked password
+	got, err := readConfig(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	back := map[string][]string{"d": {" "}, "null-if": {"a", "b,c"}, "pass": {"********"}, "q": {`"`}, "t": {"\n"}, "user": {"jprunier"}}
+	if !reflect.DeepEqual(got, back) {
+		t.Errorf("got=%q want=%q", got, back)
+	}
+}
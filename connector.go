@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+)
+
+// An initConnector runs a command on every new connection before it is used, so session
+// settings survive the pool reconnecting
+type initConnector struct {
+	driver.Connector
+	command string
+}
+
+// Connect opens a connection and runs the init command on it
+func (c *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("driver does not support running an init command")
+	}
+	if _, err = execer.ExecContext(ctx, c.command, nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("init command failed: %s", err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+// fakeConn records the statements executed on it
+type fakeConn struct {
+	driver.Conn
+	execs  []string
+	err    error
+	closed bool
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.execs = append(c.execs, query)
+	return driver.RowsAffected(0), c.err
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeConnector hands out a single fakeConn
+type fakeConnector struct {
+	driver.Connector
+	conn *fakeConn
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func TestInitConnector(t *testing.T) {
+	conn := &fakeConn{}
+	c := &initConnector{Connector: &fakeConnector{conn: conn}, command: "SET SESSION sql_mode='ANSI'"}
+	if _, err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if len(conn.execs) != 1 || conn.execs[0] != c.command {
+		t.Errorf("got=%q want=%q", conn.execs, c.command)
+	}
+
+	// A failed command closes the connection instead of handing it to the pool
+	conn = &fakeConn{err: errors.New("syntax error")}
+	c.Connector = &fakeConnector{conn: conn}
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Error("Expected an error from a failed init command")
+	}
+	if !conn.closed {
+		t.Error("Expected the connection to be closed")
+	}
+}
@@ -6,37 +6,109 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"database/sql"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
 )
 
 // A Writer writes records to a MySQL compatible CSV encoded file.
 // It is heavily influenced by the std lib encoding/CSV package.
 //
 // As returned by NewWriter, a Writer writes fields delimited by a comma, escapes special
-// characters with a back slash and lines are terminated with a newline. The exported fields
+// characters with a back slash, writes NULL as \N and lines are terminated with a newline. The exported fields
 // can be changed to customize the details before the first call to Write or WriteAll.
 type Writer struct {
 	Delimiter  string // Field delimiter (set to ',' by NewWriter)
 	Quote      string // Quote character
 	Escape     string // Escape character
 	Terminator string // Character to end each line
-	w          *bufio.Writer
+	Prefix     string // Written before each data record
+	Suffix     string // Written after each data record and before the terminator
+	Newline    string // If set, CR, LF & CRLF within fields are converted to Newline before escaping
+	Replace    string // If set, delimiters within fields are replaced by Replace instead of being escaped
+	NullString string // Written unquoted for NULL fields (set to \N by NewWriter)
+	TrimFinal  bool   // If true, the terminator is not written after the last record
+
+	// If true, quotes within fields are doubled RFC 4180 style and escape characters, NUL
+	// bytes & newlines are written as is.
+	DoubleQuote bool
+
+	// If true, fields are written as RFC 4180 describes for Excel, pandas and other standard
+	// CSV readers. Quotes are doubled as with DoubleQuote, those readers expect NullString to
+	// be empty.
+	RFC4180 bool
+
+	w       *bufio.Writer
+	pool    *sync.Pool
+	pending bool // A terminator is owed before the next record
 }
 
 // NewWriter returns a new Writer that writes to w.
 func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, 4096)
+}
+
+// NewWriterSize returns a new Writer that writes to w and buffers at least size bytes
+// between writes to the underlying io.Writer.
+func NewWriterSize(w io.Writer, size int) *Writer {
+	return newWriter(bufio.NewWriterSize(w, size))
+}
+
+// NewWriterPool returns a new Writer that writes to w through a *bufio.Writer taken from
+// pool, so many short lived Writers can share buffers. The pool's New function must return a
+// *bufio.Writer. Close returns the buffer to the pool and the Writer must not be used again.
+func NewWriterPool(w io.Writer, pool *sync.Pool) *Writer {
+	bw := pool.Get().(*bufio.Writer)
+	bw.Reset(w)
+
+	writer := newWriter(bw)
+	writer.pool = pool
+
+	return writer
+}
+
+// newWriter returns a Writer with the default format writing through w
+func newWriter(w *bufio.Writer) *Writer {
 	return &Writer{
 		Delimiter:  ",",
 		Quote:      "\"",
 		Escape:     "\\",
 		Terminator: "\n",
-		w:          bufio.NewWriter(w),
+		NullString: `\N`,
+		w:          w,
 	}
 }
 
 // Writer writes a single CSV record to w along with any necessary quoting.
 func (w *Writer) Write(record []sql.RawBytes) (buf int, err error) {
+	return w.writeRecord(record, w.Prefix, w.Suffix)
+}
+
+// WriteHeader writes the column names as a single CSV record without the line prefix or suffix.
+func (w *Writer) WriteHeader(cols []sql.RawBytes) (int, error) {
+	return w.writeRecord(cols, "", "")
+}
+
+// writeRecord writes a single CSV record wrapped in prefix and suffix
+func (w *Writer) writeRecord(record []sql.RawBytes, prefix string, suffix string) (buf int, err error) {
+	// The previous record's terminator is written once it is known not to be the last
+	if w.pending {
+		if _, err = w.w.WriteString(w.Terminator); err != nil {
+			return
+		}
+		w.pending = false
+	}
+
+	if prefix != "" {
+		if _, err = w.w.WriteString(prefix); err != nil {
+			return
+		}
+	}
+
+	double := w.DoubleQuote || w.RFC4180
 	for n, field := range record {
 		// Shortcut exit for empty strings
 		if n > 0 {
@@ -47,11 +119,16 @@ func (w *Writer) Write(record []sql.RawBytes) (buf int, err error) {
 
 		// Check if and escape/translate if field is NULL
 		if field == nil {
-			_, err = w.w.WriteString(w.Escape)
-			_, err = w.w.WriteString("N")
+			if _, err = w.w.WriteString(w.NullString); err != nil {
+				return
+			}
 			continue
 		}
 
+		if w.Newline != "" {
+			field = normalizeNewlines(field, w.Newline)
+		}
+
 		// Write quote character if set
 		if w.Quote != "" {
 			if _, err = w.w.WriteString(w.Quote); err != nil {
@@ -59,27 +136,47 @@ func (w *Writer) Write(record []sql.RawBytes) (buf int, err error) {
 			}
 		}
 
-		// We need to examine each byte to determine if special characters need to be escaped
-		for _, f := range field {
-			switch string(f) {
-			case w.Delimiter:
-				if w.Quote == "" {
+		// We need to examine each byte to determine if special characters need to be escaped.
+		// The delimiter, quote & escape may be several bytes so each is matched as a prefix of
+		// the rest of the field.
+		for i := 0; i < len(field); i++ {
+			f := field[i]
+			switch {
+			case hasToken(field[i:], w.Delimiter):
+				if w.Replace != "" {
+					_, err = w.w.WriteString(w.Replace)
+				} else if w.Quote == "" {
 					_, err = w.w.WriteString(w.Escape)
 					_, err = w.w.WriteString(w.Delimiter)
 				} else {
 					_, err = w.w.WriteString(w.Delimiter)
 				}
-			case w.Quote:
-				_, err = w.w.WriteString(w.Escape)
+				i += len(w.Delimiter) - 1
+			case hasToken(field[i:], w.Quote):
+				if double {
+					_, err = w.w.WriteString(w.Quote)
+				} else {
+					_, err = w.w.WriteString(w.Escape)
+				}
 				_, err = w.w.WriteString(w.Quote)
-			case w.Escape:
-				_, err = w.w.WriteString(w.Escape)
-				_, err = w.w.WriteString(w.Escape)
-			case string(0x00):
-				_, err = w.w.WriteString(w.Escape)
-				_, err = w.w.WriteRune('0')
-			case string(0x0A):
+				i += len(w.Quote) - 1
+			case hasToken(field[i:], w.Escape):
+				if !double {
+					_, err = w.w.WriteString(w.Escape)
+				}
 				_, err = w.w.WriteString(w.Escape)
+				i += len(w.Escape) - 1
+			case f == 0x00:
+				if double {
+					err = w.w.WriteByte(f)
+				} else {
+					_, err = w.w.WriteString(w.Escape)
+					_, err = w.w.WriteRune('0')
+				}
+			case f == '\n':
+				if !double {
+					_, err = w.w.WriteString(w.Escape)
+				}
 				err = w.w.WriteByte(f)
 			default:
 				err = w.w.WriteByte(f)
@@ -98,8 +195,18 @@ func (w *Writer) Write(record []sql.RawBytes) (buf int, err error) {
 		}
 	}
 
+	if suffix != "" {
+		if _, err = w.w.WriteString(suffix); err != nil {
+			return
+		}
+	}
+
 	// Write line terminator
-	_, err = w.w.WriteString(w.Terminator)
+	if w.TrimFinal {
+		w.pending = true
+	} else {
+		_, err = w.w.WriteString(w.Terminator)
+	}
 
 	// Return the number of bytes written to the current buffer
 	buf = w.w.Buffered()
@@ -107,12 +214,75 @@ func (w *Writer) Write(record []sql.RawBytes) (buf int, err error) {
 	return buf, err
 }
 
+// hasToken reports if field starts with a delimiter, quote or escape token, empty tokens
+// never match
+func hasToken(field []byte, token string) bool {
+	if token == "" || len(field) < len(token) {
+		return false
+	}
+	if len(token) == 1 {
+		return field[0] == token[0]
+	}
+
+	return string(field[:len(token)]) == token
+}
+
+// checkReplacement returns an error if replace, which is written in place of delimiters inside
+// fields, contains the delimiter, quote, escape or terminator
+func checkReplacement(replace string, delimiter string, quote string, escape string, terminator string) error {
+	for _, token := range []struct{ name, value string }{{"delimiter", delimiter}, {"quote", quote}, {"escape", escape}, {"terminator", terminator}} {
+		if token.value != "" && strings.Contains(replace, token.value) {
+			return fmt.Errorf("-replace-delimiter %q can not contain the %s %q!", replace, token.name, token.value)
+		}
+	}
+
+	return nil
+}
+
+// normalizeNewlines converts every CR, LF & CRLF in field to newline
+func normalizeNewlines(field []byte, newline string) []byte {
+	if bytes.IndexAny(field, "\r\n") < 0 {
+		return field
+	}
+
+	out := make([]byte, 0, len(field)+len(newline))
+	for i := 0; i < len(field); i++ {
+		switch field[i] {
+		case '\r':
+			if i+1 < len(field) && field[i+1] == '\n' {
+				i++
+			}
+			out = append(out, newline...)
+		case '\n':
+			out = append(out, newline...)
+		default:
+			out = append(out, field[i])
+		}
+	}
+
+	return out
+}
+
 // Flush writes any buffered data to the underlying io.Writer.
 // To check if an error occurred during the Flush, call Error.
 func (w *Writer) Flush() {
 	w.w.Flush()
 }
 
+// Close flushes the remaining output and returns a pooled buffer to its pool. The underlying
+// io.Writer is not closed.
+func (w *Writer) Close() error {
+	err := w.w.Flush()
+	if w.pool != nil {
+		w.w.Reset(nil)
+		w.pool.Put(w.w)
+		w.w = nil
+		w.pool = nil
+	}
+
+	return err
+}
+
 // Error reports any error that has occurred during a previous Write or Flush.
 func (w *Writer) Error() error {
 	_, err := w.w.Write(nil)
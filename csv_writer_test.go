@@ -5,10 +5,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"database/sql"
 	"errors"
+	"io/ioutil"
+	"sync"
 	"testing"
+	"time"
 )
 
 // The output must have start and end quotes added as the tests use a default writer
@@ -56,6 +60,123 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWriteDoubleQuote(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewWriter(b)
+	f.DoubleQuote = true
+	err := f.WriteAll([][]sql.RawBytes{
+		{[]byte(`a"b`), []byte(`c\d`), nil},
+		{[]byte("e\nf,g"), []byte("h\x00")},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	want := `"a""b","c\d",\N` + "\n" + "\"e\nf,g\",\"h\x00\"\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+// writeTests with quotes doubled and newlines written as is for RFC 4180 output
+var writeRFC4180Tests = []struct {
+	Input  [][]sql.RawBytes
+	Output string
+}{
+	{Input: [][]sql.RawBytes{{[]byte("abc")}}, Output: "\"abc\"\n"},
+	{Input: [][]sql.RawBytes{{[]byte(`"abc"`)}}, Output: `"""abc"""` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte(`a"b`)}}, Output: `"a""b"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte(`"a"b"`)}}, Output: `"""a""b"""` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte(" abc")}}, Output: `" abc"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("abc,def")}}, Output: `"abc,def"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("abc"), []byte("def")}}, Output: `"abc","def"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("abc")}, {[]byte("def")}}, Output: `"abc"` + "\n" + `"def"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("abc\ndef")}}, Output: "\"abc\ndef\"\n"},
+	{Input: [][]sql.RawBytes{{[]byte("abc\rdef")}}, Output: "\"abc\rdef\"\n"},
+	{Input: [][]sql.RawBytes{{[]byte("")}}, Output: `""` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte(""), []byte("")}}, Output: "\"\",\"\"\n"},
+	{Input: [][]sql.RawBytes{{[]byte(""), nil, []byte("a")}}, Output: "\"\",,\"a\"\n"},
+	{Input: [][]sql.RawBytes{{nil}}, Output: "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a"), nil}}, Output: "\"a\",\n"},
+	{Input: [][]sql.RawBytes{{[]byte(`\N`)}}, Output: `"\N"` + "\n"},
+	{Input: [][]sql.RawBytes{{[]byte(`\.`)}}, Output: `"\."` + "\n"},
+}
+
+func TestWriteRFC4180(t *testing.T) {
+	for n, tt := range writeRFC4180Tests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.RFC4180 = true
+		f.NullString = ""
+		err := f.WriteAll(tt.Input)
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestWriteNullString(t *testing.T) {
+	for _, tt := range []struct {
+		null  string
+		quote string
+		want  string
+	}{
+		{`\N`, `"`, `"a",\N,""` + "\n"},
+		{"NULL", `"`, `"a",NULL,""` + "\n"},
+		{"", `"`, `"a",,""` + "\n"},
+		{"NULL", "", "a,NULL,\n"},
+		{"", "", "a,,\n"},
+	} {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.NullString = tt.null
+		f.Quote = tt.quote
+		err := f.WriteAll([][]sql.RawBytes{{[]byte("a"), nil, []byte("")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("null=%q quote=%q: got=%q want=%q", tt.null, tt.quote, got, tt.want)
+		}
+	}
+}
+
+func TestWriteMultiByte(t *testing.T) {
+	for _, tt := range []struct {
+		delimiter, quote, escape string
+		want                     string
+	}{
+		{"||", `"`, `\`, `"a|b"||"c||d"||"e|"||"|f"` + "\n"},
+		{"||", "", `\`, `a|b||c\||d||e||||f` + "\n"},
+		{"¦", "", `\`, `a|b¦c||d¦e|¦|f` + "\n"},
+		{",", "''", "~~", `''a|b'',''c||d'',''e|'',''|f''` + "\n"},
+	} {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Delimiter, f.Quote, f.Escape = tt.delimiter, tt.quote, tt.escape
+		err := f.WriteAll([][]sql.RawBytes{{[]byte("a|b"), []byte("c||d"), []byte("e|"), []byte("|f")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("d=%q q=%q e=%q: got=%q want=%q", tt.delimiter, tt.quote, tt.escape, got, tt.want)
+		}
+	}
+
+	// Multi byte quotes & escapes within fields are escaped whole
+	b := &bytes.Buffer{}
+	f := NewWriter(b)
+	f.Quote, f.Escape = "''", "~~"
+	f.WriteAll([][]sql.RawBytes{{[]byte("it''s ~~ 'one' ~")}})
+	if got, want := b.String(), "''it~~''s ~~~~ 'one' ~''\n"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
 type errorWriter struct{}
 
 func (e errorWriter) Write(b []byte) (int, error) {
@@ -141,3 +262,256 @@ func BenchmarkWriteBaconIpsum(b *testing.B) {
 		}
 	}
 }
+
+// slowWriter simulates a network filesystem where every write carries a fixed latency
+type slowWriter struct{}
+
+func (s slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Microsecond * 50)
+	return len(b), nil
+}
+
+func benchmarkSlowWriter(b *testing.B, size int) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f := NewWriterSize(slowWriter{}, size)
+		for j := 0; j < 10000; j++ {
+			f.Write([]sql.RawBytes{[]byte(`abcdef`), []byte(`ghijkl`), []byte(`mnopqr`)})
+		}
+		f.Flush()
+		err := f.Error()
+
+		if err != nil {
+			b.Errorf("Unexpected error: %s\n", err)
+		}
+	}
+}
+
+func BenchmarkWriteSlowWriterDefaultBuffer(b *testing.B) {
+	benchmarkSlowWriter(b, 4096)
+}
+
+func BenchmarkWriteSlowWriterLargeBuffer(b *testing.B) {
+	benchmarkSlowWriter(b, 4*1024*1024)
+}
+
+func TestWriterPool(t *testing.T) {
+	pool := &sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, 4096) }}
+
+	for _, want := range []string{"\"a\"\n", "\"b\"\n"} {
+		b := &bytes.Buffer{}
+		f := NewWriterPool(b, pool)
+		f.Write([]sql.RawBytes{[]byte(want[1:2])})
+		if err := f.Close(); err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+
+		if got := b.String(); got != want {
+			t.Errorf("got=%q want=%q", got, want)
+		}
+	}
+}
+
+// benchmarkConcurrentExports runs many small exports in parallel, each with its own Writer
+func benchmarkConcurrentExports(b *testing.B, newWriter func() *Writer) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f := newWriter()
+			for j := 0; j < 10; j++ {
+				f.Write([]sql.RawBytes{[]byte(`abcdef`), []byte(`ghijkl`), []byte(`mnopqr`)})
+			}
+			err := f.Close()
+
+			if err != nil {
+				b.Errorf("Unexpected error: %s\n", err)
+			}
+		}
+	})
+}
+
+func BenchmarkWriteConcurrentExports(b *testing.B) {
+	benchmarkConcurrentExports(b, func() *Writer {
+		return NewWriterSize(ioutil.Discard, 64*1024)
+	})
+}
+
+func BenchmarkWriteConcurrentExportsPool(b *testing.B) {
+	pool := &sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, 64*1024) }}
+	benchmarkConcurrentExports(b, func() *Writer {
+		return NewWriterPool(ioutil.Discard, pool)
+	})
+}
+
+func TestWriteTrimFinal(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewWriter(b)
+	f.TrimFinal = true
+	f.WriteHeader([]sql.RawBytes{[]byte("a")})
+	f.Write([]sql.RawBytes{[]byte("1")})
+	f.Flush()
+	if got, want := b.String(), "\"a\"\n\"1\""; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+
+	f.Write([]sql.RawBytes{[]byte("2")})
+	if err := f.Close(); err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if got, want := b.String(), "\"a\"\n\"1\"\n\"2\""; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+var prefixTests = []struct {
+	Prefix string
+	Suffix string
+	Output string
+}{
+	{Prefix: "", Suffix: "", Output: "\"a\",\"b\"\n\"1\",\"2\"\n"},
+	{Prefix: "BEGIN|", Suffix: "", Output: "\"a\",\"b\"\nBEGIN|\"1\",\"2\"\n"},
+	{Prefix: "", Suffix: "|END", Output: "\"a\",\"b\"\n\"1\",\"2\"|END\n"},
+	{Prefix: "BEGIN|", Suffix: "|END", Output: "\"a\",\"b\"\nBEGIN|\"1\",\"2\"|END\n"},
+}
+
+func TestWritePrefixSuffix(t *testing.T) {
+	for n, tt := range prefixTests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Prefix = tt.Prefix
+		f.Suffix = tt.Suffix
+		f.WriteHeader([]sql.RawBytes{[]byte("a"), []byte("b")})
+		f.Write([]sql.RawBytes{[]byte("1"), []byte("2")})
+		f.Flush()
+		err := f.Error()
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestWriteNulTerminator(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewWriter(b)
+	f.Quote = ""
+	f.Terminator = "\x00"
+	err := f.WriteAll([][]sql.RawBytes{{[]byte("a b")}, {[]byte("c\x00d")}, {[]byte("e")}})
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	want := "a b\x00c\\0d\x00e\x00"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+var newlineTests = []struct {
+	Newline string
+	Input   string
+	Output  string
+}{
+	{Newline: "", Input: "a\r\nb\rc\nd", Output: "\"a\r\\\nb\rc\\\nd\"\n"},
+	{Newline: "\n", Input: "a\r\nb\rc\nd", Output: "\"a\\\nb\\\nc\\\nd\"\n"},
+	{Newline: "\r\n", Input: "a\r\nb\rc\nd", Output: "\"a\r\\\nb\r\\\nc\r\\\nd\"\n"},
+	{Newline: "\r", Input: "a\r\nb\rc\nd", Output: "\"a\rb\rc\rd\"\n"},
+	{Newline: "\n", Input: "\n\r\r\n", Output: "\"\\\n\\\n\\\n\"\n"},
+	{Newline: "\n", Input: "abc", Output: "\"abc\"\n"},
+}
+
+func TestWriteNormalizeNewlines(t *testing.T) {
+	for n, tt := range newlineTests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Newline = tt.Newline
+		err := f.WriteAll([][]sql.RawBytes{{[]byte(tt.Input)}})
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+// A field holding the literal NULL marker must stay distinguishable from a real NULL
+var nullLiteralTests = []struct {
+	Quote  string
+	Input  []sql.RawBytes
+	Output string
+}{
+	{Quote: "", Input: []sql.RawBytes{nil, []byte(`\N`)}, Output: `\N,\\N` + "\n"},
+	{Quote: "", Input: []sql.RawBytes{[]byte(`a\Nb`), nil}, Output: `a\\Nb,\N` + "\n"},
+	{Quote: "", Input: []sql.RawBytes{[]byte("N"), nil}, Output: `N,\N` + "\n"},
+	{Quote: "\"", Input: []sql.RawBytes{nil, []byte(`\N`)}, Output: `\N,"\\N"` + "\n"},
+}
+
+func TestWriteNullLiteral(t *testing.T) {
+	for n, tt := range nullLiteralTests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Quote = tt.Quote
+		err := f.WriteAll([][]sql.RawBytes{tt.Input})
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+var replaceTests = []struct {
+	Quote  string
+	Output string
+}{
+	{Quote: "\"", Output: "\"a;b\",\"c\",\\N,\";;\"\n"},
+	{Quote: "", Output: "a;b,c,\\N,;;\n"},
+}
+
+func TestWriteReplaceDelimiter(t *testing.T) {
+	for n, tt := range replaceTests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Quote = tt.Quote
+		f.Replace = ";"
+		err := f.WriteAll([][]sql.RawBytes{{[]byte("a,b"), []byte("c"), nil, []byte(",,")}})
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestCheckReplacement(t *testing.T) {
+	for n, tt := range []struct {
+		Replace string
+		Valid   bool
+	}{
+		{Replace: ";", Valid: true},
+		{Replace: "<comma>", Valid: true},
+		{Replace: ",", Valid: false},
+		{Replace: "a,b", Valid: false},
+		{Replace: `"`, Valid: false},
+		{Replace: `\,`, Valid: false},
+		{Replace: "\n", Valid: false},
+	} {
+		err := checkReplacement(tt.Replace, ",", `"`, `\`, "\n")
+		if (err == nil) != tt.Valid {
+			t.Errorf("#%d: %q got=%v want valid=%v", n, tt.Replace, err, tt.Valid)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// loadHashes reads the row hash column of a previous CSV export into a set. The file must
+// have a header line and use the same delimiter, quote, escape & terminator as this export.
+// Each hash held costs roughly 50 bytes plus the length of the hash.
+func (exi *exportInfo) loadHashes(name string) (map[string]struct{}, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]struct{})
+	col := -1
+	err = readRecords(f, exi.delimiter, exi.quote, exi.readEscape(), exi.terminator, func(record [][]byte) error {
+		if col < 0 {
+			for i, field := range record {
+				if string(field) == exi.hashColumn {
+					col = i
+				}
+			}
+			if col < 0 {
+				return fmt.Errorf("%s has no %s column in its header", name, exi.hashColumn)
+			}
+			return nil
+		}
+
+		if col < len(record) {
+			hashes[string(record[col])] = struct{}{}
+		}
+		return nil
+	})
+	if err == nil && col < 0 {
+		err = fmt.Errorf("%s has no header line", name)
+	}
+
+	return hashes, err
+}
+
+// readRecords splits CSV written by Writer into records, calling fn with the unquoted &
+// unescaped fields of each. Fields passed to fn are only valid until fn returns.
+func readRecords(r io.Reader, delimiter string, quote string, escape string, terminator string, fn func([][]byte) error) error {
+	br := bufio.NewReader(r)
+
+	var record [][]byte
+	var field []byte
+	var quoted bool
+	var dirty bool
+
+	// at reports if the upcoming input matches s, consuming it if so
+	at := func(s string) bool {
+		if s == "" {
+			return false
+		}
+		b, _ := br.Peek(len(s))
+		if string(b) != s {
+			return false
+		}
+		br.Discard(len(s))
+		return true
+	}
+
+	for {
+		switch {
+		case !quoted && at(terminator):
+			record = append(record, field)
+			if err := fn(record); err != nil {
+				return err
+			}
+			record, field, dirty = record[:0], nil, false
+			continue
+		case !quoted && at(delimiter):
+			record = append(record, field)
+			field = nil
+			continue
+		case at(escape):
+			b, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b == '0' {
+				b = 0
+			}
+			field = append(field, b)
+			dirty = true
+			continue
+		case at(quote):
+			// A doubled quote within a quoted field is a literal quote
+			if quoted && at(quote) {
+				field = append(field, quote...)
+			} else {
+				quoted = !quoted
+			}
+			dirty = true
+			continue
+		}
+
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			// A final record may be missing its terminator
+			if dirty || len(record) > 0 {
+				return fn(append(record, field))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		field = append(field, b)
+		dirty = true
+	}
+}
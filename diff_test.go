@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRecords(t *testing.T) {
+	in := "\"a\",\"b\"\n\"x,y\",\"q\\\"z\\\\\"\n\"line\\\nbreak\",\\N\n\"last\",\"\""
+	want := [][]string{{"a", "b"}, {"x,y", "q\"z\\"}, {"line\nbreak", "N"}, {"last", ""}}
+
+	var got [][]string
+	err := readRecords(strings.NewReader(in), ",", "\"", "\\", "\n", func(record [][]byte) error {
+		var r []string
+		for _, f := range record {
+			r = append(r, string(f))
+		}
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%q\nwant=%q", got, want)
+	}
+}
+
+func TestLoadHashes(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "prev.csv")
+	err := os.WriteFile(name, []byte("\"id\",\"row_hash\"\n\"1\",\"aa\"\n\"2\",\"bb\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exi := exportInfo{delimiter: ",", quote: "\"", escape: "\\", terminator: "\n", hashColumn: "row_hash"}
+	hashes, err := exi.loadHashes(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	want := map[string]struct{}{"aa": {}, "bb": {}}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Errorf("got=%v want=%v", hashes, want)
+	}
+
+	exi.hashColumn = "missing"
+	if _, err = exi.loadHashes(name); err == nil {
+		t.Error("Expected an error for a missing hash column")
+	}
+}
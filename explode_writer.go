@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxFileName is the longest file name in bytes most file systems allow
+const maxFileName = 255
+
+// An ExplodeWriter writes the content field of each record verbatim to its own file in Dir,
+// named after the record's name field. Names are made safe for any file system and repeated
+// or existing names get a numeric suffix, so a.png, a.png becomes a.png, a_2.png. NULL
+// contents are written as empty files. The header is not written.
+type ExplodeWriter struct {
+	Dir     string // Directory the files are created in
+	Name    int    // Index of the field holding each file's name (set to 0 by NewExplodeWriter)
+	Content int    // Index of the field holding each file's contents (set to 1 by NewExplodeWriter)
+	used    map[string]bool
+	rows    int
+}
+
+// NewExplodeWriter returns a new ExplodeWriter that creates files in dir.
+func NewExplodeWriter(dir string) *ExplodeWriter {
+	return &ExplodeWriter{Dir: dir, Content: 1, used: make(map[string]bool)}
+}
+
+// WriteHeader does nothing, exploded files have no header.
+func (w *ExplodeWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	return 0, nil
+}
+
+// Write creates a file for a single record.
+func (w *ExplodeWriter) Write(record []sql.RawBytes) (int, error) {
+	w.rows++
+	base := sanitizeFileName(string(record[w.Name]))
+	if base == "" {
+		base = "row_" + strconv.Itoa(w.rows)
+	}
+
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = stem + "_" + strconv.Itoa(n) + ext
+		}
+
+		// Names are compared case insensitively for case insensitive file systems
+		if w.used[strings.ToLower(name)] {
+			continue
+		}
+		path := filepath.Join(w.Dir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		w.used[strings.ToLower(name)] = true
+
+		counter := &countingOutput{WriteCloser: f}
+		report.addFile(&outputFile{name: path, rows: 1, bytes: counter})
+		_, err = counter.Write(record[w.Content])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		return 0, err
+	}
+}
+
+// sanitizeFileName replaces characters that are not allowed in file names on common file
+// systems with an underscore. Names left empty once dots & spaces are trimmed return "".
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows ignores trailing dots & spaces
+	name = strings.TrimRight(strings.TrimLeft(name, " "), ". ")
+	if name == "" {
+		return ""
+	}
+
+	if len(name) > maxFileName {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = truncateUTF8(strings.TrimSuffix(name, ext), maxFileName-len(ext)-8) + ext
+	}
+
+	return name
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a multi byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xc0 == 0x80 {
+		n--
+	}
+
+	return s[:n]
+}
+
+// explodeColumns finds the name & content columns of a two column query
+func explodeColumns(cols []sql.RawBytes, name string, content string, caseSensitive bool) (int, int, error) {
+	if len(cols) != 2 {
+		return 0, 0, fmt.Errorf("-explode requires a two column query, the query returned %d columns", len(cols))
+	}
+
+	for i := range cols {
+		if columnMatch(string(cols[i]), name, caseSensitive) && columnMatch(string(cols[1-i]), content, caseSensitive) {
+			return i, 1 - i, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("-explode columns %s and %s are not the query's columns", name, content)
+}
+
+// Flush does nothing, each file is closed as it is written.
+func (w *ExplodeWriter) Flush() {}
+
+// Close does nothing, each file is closed as it is written.
+func (w *ExplodeWriter) Close() error {
+	return nil
+}
+
+// Error always returns nil, write errors are returned by Write.
+func (w *ExplodeWriter) Error() error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplodeWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mycsv-explode-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An existing file is never overwritten
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewExplodeWriter(dir)
+	f.Name, f.Content = 1, 0
+	for _, record := range [][]sql.RawBytes{
+		{[]byte("one"), []byte("a.png")},
+		{[]byte("two"), []byte("A.png")},
+		{[]byte("three"), []byte("b.txt")},
+		{nil, []byte("../x/y")},
+		{[]byte("five"), nil},
+	} {
+		if _, err := f.Write(record); err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+	}
+
+	want := map[string]string{
+		"a.png":   "one",
+		"A_2.png": "two",
+		"b.txt":   "old",
+		"b_2.txt": "three",
+		".._x_y":  "",
+		"row_5":   "five",
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != len(want) {
+		var names []string
+		for _, fi := range files {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("got files %q", names)
+	}
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		} else if string(got) != content {
+			t.Errorf("%s: got=%q want=%q", name, got, content)
+		}
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	for in, want := range map[string]string{
+		"report.pdf":  "report.pdf",
+		"a/b\\c:d*?":  "a_b_c_d__",
+		" spaced. . ": "spaced",
+		"..":          "",
+		"":            "",
+		"tab\there\n": "tab_here_",
+		"über straße": "über straße",
+	} {
+		if got := sanitizeFileName(in); got != want {
+			t.Errorf("%q: got=%q want=%q", in, got, want)
+		}
+	}
+
+	long := sanitizeFileName(strings.Repeat("é", 200) + ".jpg")
+	if len(long) > maxFileName || !strings.HasSuffix(long, "é.jpg") {
+		t.Errorf("long name not truncated cleanly: %d bytes %q", len(long), long[len(long)-10:])
+	}
+}
+
+func TestExplodeColumns(t *testing.T) {
+	cols := []sql.RawBytes{[]byte("Data"), []byte("name")}
+	name, content, err := explodeColumns(cols, "name", "data", false)
+	if err != nil || name != 1 || content != 0 {
+		t.Errorf("got name=%d content=%d err=%v", name, content, err)
+	}
+
+	if _, _, err := explodeColumns(cols, "name", "other", false); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if _, _, err := explodeColumns(append(cols, []byte("x")), "name", "data", false); err == nil {
+		t.Error("expected an error for three columns")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"html"
+	"io"
+)
+
+// An HTMLWriter writes records as rows of an HTML table.
+//
+// The header is written as a thead row and records are streamed as tbody rows, the table is
+// opened by the first write and closed by Close. Field values are HTML escaped and nil fields
+// are written as empty cells with a null class so they can be told apart from empty strings.
+type HTMLWriter struct {
+	Class  string // If set, written as the table's class attribute
+	open   bool
+	inBody bool
+	w      *bufio.Writer
+}
+
+// NewHTMLWriter returns a new HTMLWriter that writes to w.
+func NewHTMLWriter(w io.Writer) *HTMLWriter {
+	return NewHTMLWriterSize(w, 4096)
+}
+
+// NewHTMLWriterSize returns a new HTMLWriter that writes to w and buffers at least size bytes
+// between writes to the underlying io.Writer.
+func NewHTMLWriterSize(w io.Writer, size int) *HTMLWriter {
+	return &HTMLWriter{w: bufio.NewWriterSize(w, size)}
+}
+
+// WriteHeader writes the column names as the table's head row.
+func (w *HTMLWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	w.openTable()
+	w.w.WriteString("<thead>\n")
+	w.writeRow(cols, "th")
+	_, err := w.w.WriteString("</thead>\n")
+
+	return w.w.Buffered(), err
+}
+
+// Write writes a single record as a table body row.
+func (w *HTMLWriter) Write(record []sql.RawBytes) (int, error) {
+	w.openTable()
+	if !w.inBody {
+		w.w.WriteString("<tbody>\n")
+		w.inBody = true
+	}
+	err := w.writeRow(record, "td")
+
+	return w.w.Buffered(), err
+}
+
+// openTable writes the table start tag once
+func (w *HTMLWriter) openTable() {
+	if w.open {
+		return
+	}
+
+	if w.Class != "" {
+		w.w.WriteString(`<table class="` + html.EscapeString(w.Class) + `">` + "\n")
+	} else {
+		w.w.WriteString("<table>\n")
+	}
+	w.open = true
+}
+
+// writeRow writes fields as cells of a single row using the cell tag
+func (w *HTMLWriter) writeRow(fields []sql.RawBytes, tag string) error {
+	w.w.WriteString("<tr>")
+	for _, field := range fields {
+		if field == nil {
+			w.w.WriteString("<" + tag + ` class="null"></` + tag + ">")
+			continue
+		}
+		w.w.WriteString("<" + tag + ">")
+		w.w.WriteString(html.EscapeString(string(field)))
+		w.w.WriteString("</" + tag + ">")
+	}
+	_, err := w.w.WriteString("</tr>\n")
+
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *HTMLWriter) Flush() {
+	w.w.Flush()
+}
+
+// Close ends the table and flushes the remaining output. The underlying io.Writer is not closed.
+func (w *HTMLWriter) Close() error {
+	w.openTable()
+	if w.inBody {
+		w.w.WriteString("</tbody>\n")
+	}
+	w.w.WriteString("</table>\n")
+
+	return w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *HTMLWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
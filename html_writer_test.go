@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestHTMLWrite(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewHTMLWriter(b)
+	f.Class = `report "q1"`
+	f.WriteHeader([]sql.RawBytes{[]byte("id"), []byte("a<b")})
+	f.Write([]sql.RawBytes{[]byte("1"), []byte(`"x" & 'y'`)})
+	f.Write([]sql.RawBytes{[]byte("2"), nil})
+	f.Write([]sql.RawBytes{[]byte("3"), []byte("")})
+	err := f.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	want := `<table class="report &#34;q1&#34;">` + "\n" +
+		"<thead>\n" +
+		"<tr><th>id</th><th>a&lt;b</th></tr>\n" +
+		"</thead>\n" +
+		"<tbody>\n" +
+		"<tr><td>1</td><td>&#34;x&#34; &amp; &#39;y&#39;</td></tr>\n" +
+		`<tr><td>2</td><td class="null"></td></tr>` + "\n" +
+		"<tr><td>3</td><td></td></tr>\n" +
+		"</tbody>\n" +
+		"</table>\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=\n%s\nwant=\n%s", got, want)
+	}
+}
+
+func TestHTMLWriteEmpty(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewHTMLWriter(b)
+	err := f.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	if got, want := b.String(), "<table>\n</table>\n"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
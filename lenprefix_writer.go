@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"io"
+)
+
+// lenPrefixNull is the field length written for NULL fields
+const lenPrefixNull = 0xFFFFFFFF
+
+// A LenPrefixWriter writes records in a length prefixed binary framing so no escaping is needed.
+//
+// Each record starts with its field count as a 4 byte big endian integer. Each field follows
+// as a 4 byte big endian length and the raw field bytes, nil fields have a length of
+// 0xFFFFFFFF and no bytes. The header, if written, is framed the same as a record.
+type LenPrefixWriter struct {
+	w *bufio.Writer
+}
+
+// NewLenPrefixWriter returns a new LenPrefixWriter that writes to w.
+func NewLenPrefixWriter(w io.Writer) *LenPrefixWriter {
+	return NewLenPrefixWriterSize(w, 4096)
+}
+
+// NewLenPrefixWriterSize returns a new LenPrefixWriter that writes to w and buffers at least
+// size bytes between writes to the underlying io.Writer.
+func NewLenPrefixWriterSize(w io.Writer, size int) *LenPrefixWriter {
+	return &LenPrefixWriter{w: bufio.NewWriterSize(w, size)}
+}
+
+// WriteHeader writes the column names as a single record.
+func (w *LenPrefixWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	return w.Write(cols)
+}
+
+// Write writes a single record with its field count and field lengths.
+func (w *LenPrefixWriter) Write(record []sql.RawBytes) (buf int, err error) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(record)))
+	if _, err = w.w.Write(n[:]); err != nil {
+		return
+	}
+
+	for _, field := range record {
+		if field == nil {
+			binary.BigEndian.PutUint32(n[:], lenPrefixNull)
+		} else {
+			binary.BigEndian.PutUint32(n[:], uint32(len(field)))
+		}
+		if _, err = w.w.Write(n[:]); err != nil {
+			return
+		}
+
+		if _, err = w.w.Write(field); err != nil {
+			return
+		}
+	}
+
+	// Return the number of bytes written to the current buffer
+	buf = w.w.Buffered()
+
+	return buf, err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *LenPrefixWriter) Flush() {
+	w.w.Flush()
+}
+
+// Close flushes the remaining output. The underlying io.Writer is not closed.
+func (w *LenPrefixWriter) Close() error {
+	return w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *LenPrefixWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+var lenPrefixTests = []struct {
+	Input  [][]sql.RawBytes
+	Output string
+}{
+	{Input: [][]sql.RawBytes{{[]byte("abc")}}, Output: "\x00\x00\x00\x01\x00\x00\x00\x03abc"},
+	{Input: [][]sql.RawBytes{{[]byte("a,\"b\n"), []byte("")}}, Output: "\x00\x00\x00\x02\x00\x00\x00\x05a,\"b\n\x00\x00\x00\x00"},
+	{Input: [][]sql.RawBytes{{nil, []byte("x")}}, Output: "\x00\x00\x00\x02\xff\xff\xff\xff\x00\x00\x00\x01x"},
+	{Input: [][]sql.RawBytes{{[]byte("1")}, {[]byte("22")}}, Output: "\x00\x00\x00\x01\x00\x00\x00\x011\x00\x00\x00\x01\x00\x00\x00\x0222"},
+	{Input: [][]sql.RawBytes{{}}, Output: "\x00\x00\x00\x00"},
+}
+
+func TestLenPrefixWrite(t *testing.T) {
+	for n, tt := range lenPrefixTests {
+		b := &bytes.Buffer{}
+		f := NewLenPrefixWriter(b)
+		for _, record := range tt.Input {
+			_, err := f.Write(record)
+			if err != nil {
+				t.Errorf("Unexpected error: %s\n", err)
+			}
+		}
+		err := f.Close()
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestLenPrefixWriteHeader(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewLenPrefixWriter(b)
+	f.WriteHeader([]sql.RawBytes{[]byte("id")})
+	f.Write([]sql.RawBytes{[]byte("7")})
+	f.Close()
+
+	want := "\x00\x00\x00\x01\x00\x00\x00\x02id\x00\x00\x00\x01\x00\x00\x00\x017"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
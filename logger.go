@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// A messageLogger writes informational, verbose and progress messages so stdout is
+// left purely for CSV output. Messages are human readable text unless json is set,
+// in which case each message is written as a single line JSON event. When status is
+// set progress is a status line rewritten in place rather than a row of dots.
+type messageLogger struct {
+	w         io.Writer
+	json      bool
+	status    bool
+	statusLen int
+}
+
+// Messages are written to stderr unless main() points the logger at a log file
+var logger = &messageLogger{w: os.Stderr}
+
+// Println writes a message followed by a newline
+func (l *messageLogger) Println(a ...interface{}) {
+	if l.json {
+		l.event("message", map[string]interface{}{"message": strings.TrimSuffix(fmt.Sprintln(a...), "\n")})
+		return
+	}
+
+	fmt.Fprintln(l.w, a...)
+}
+
+// Printf writes a formatted message
+func (l *messageLogger) Printf(format string, a ...interface{}) {
+	if l.json {
+		l.event("message", map[string]interface{}{"message": strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")})
+		return
+	}
+
+	fmt.Fprintf(l.w, format, a...)
+}
+
+// Start reports where output will be written
+func (l *messageLogger) Start(destination string) {
+	if l.json {
+		l.event("start", map[string]interface{}{"destination": destination})
+		return
+	}
+
+	fmt.Fprintln(l.w, "CSV output will be written to", destination)
+	if l.status {
+		fmt.Fprintln(l.w, "Progress will be shown every second")
+		return
+	}
+	fmt.Fprintln(l.w, "A '.' will be shown for every 10,000 CSV rows written")
+}
+
+// Progress reports the number of rows written so far
+func (l *messageLogger) Progress(rows uint) {
+	if l.json {
+		l.event("progress", map[string]interface{}{"rows": rows})
+		return
+	}
+
+	fmt.Fprint(l.w, ".")
+}
+
+// Status rewrites the status line with the rows & bytes written so far and the average rate
+func (l *messageLogger) Status(rows uint, bytes int64, elapsed time.Duration) {
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(rows) / elapsed.Seconds()
+	}
+
+	// Pad with spaces to cover a longer previous line
+	line := fmt.Sprintf("%d rows, %.1f MB written, %.0f rows/sec", rows, float64(bytes)/(1024*1024), rate)
+	pad := l.statusLen - len(line)
+	l.statusLen = len(line)
+	if pad < 0 {
+		pad = 0
+	}
+
+	fmt.Fprint(l.w, "\r"+line+strings.Repeat(" ", pad))
+}
+
+// Flush reports buffered output being written, it is only reported as a JSON event
+func (l *messageLogger) Flush(rows uint, bytes int) {
+	if l.json {
+		l.event("flush", map[string]interface{}{"rows": rows, "bytes": bytes})
+	}
+}
+
+// Complete reports the totals and average rate for a finished export
+func (l *messageLogger) Complete(rows uint, runtime time.Duration) {
+	var rate float64
+	if runtime > 0 {
+		rate = float64(rows) / runtime.Seconds()
+	}
+	if l.json {
+		l.event("complete", map[string]interface{}{"rows": rows, "duration_seconds": runtime.Seconds(), "rows_per_second": rate})
+		return
+	}
+
+	fmt.Fprintln(l.w)
+	fmt.Fprintln(l.w, rows, "rows written")
+	fmt.Fprintln(l.w, "Total runtime =", runtime)
+	fmt.Fprintf(l.w, "Average rate = %.0f rows/sec\n", rate)
+}
+
+// event writes a single JSON event line
+func (l *messageLogger) event(name string, fields map[string]interface{}) {
+	fields["event"] = name
+	fields["time"] = time.Now().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	l.w.Write(append(b, '\n'))
+}
+
+// Profile reports the -profile column statistics, as a table unless JSON is set
+func (l *messageLogger) Profile(profiles []*columnProfile) {
+	if l.json {
+		columns := make([]map[string]interface{}, len(profiles))
+		for i, p := range profiles {
+			columns[i] = map[string]interface{}{"column": p.name, "non_null": p.nonNull, "approx_distinct": p.distinct.Count()}
+			if p.nonNull > 0 {
+				columns[i]["min_length"] = p.minLen
+				columns[i]["max_length"] = p.maxLen
+			}
+		}
+		l.event("profile", map[string]interface{}{"columns": columns})
+		return
+	}
+
+	header, rows := profileTable(profiles)
+	tw := NewTableWriter(l.w)
+	tw.WriteHeader(header)
+	for _, row := range rows {
+		tw.Write(row)
+	}
+	tw.Close()
+}
+
+// A progressWriter counts the bytes written to an output for the status line
+type progressWriter struct {
+	io.Writer
+	n int64
+}
+
+// Write writes p to the output and adds the bytes written to the count
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.Writer.Write(b)
+	p.n += int64(n)
+
+	return n, err
+}
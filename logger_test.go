@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerText(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := &messageLogger{w: b}
+	l.Progress(10000)
+	l.Flush(10000, 100)
+	l.Complete(10000, time.Second)
+
+	want := ".\n10000 rows written\nTotal runtime = 1s\nAverage rate = 10000 rows/sec\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestLoggerStatus(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := &messageLogger{w: b, status: true}
+	l.Status(25000, 10*1024*1024, 2*time.Second)
+	l.Status(5, 0, time.Second)
+	l.Complete(5, time.Second)
+
+	want := "\r25000 rows, 10.0 MB written, 12500 rows/sec" +
+		"\r5 rows, 0.0 MB written, 5 rows/sec         " +
+		"\n5 rows written\nTotal runtime = 1s\nAverage rate = 5 rows/sec\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := &messageLogger{w: b, json: true}
+	l.Start("my.csv")
+	l.Progress(10000)
+	l.Flush(10000, 100)
+	l.Printf("Warning: %s\n", "test")
+	l.Complete(10000, time.Second)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	events := []string{"start", "progress", "flush", "message", "complete"}
+	if len(lines) != len(events) {
+		t.Fatalf("got %d lines want %d", len(lines), len(events))
+	}
+
+	for n, line := range lines {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+		if e["event"] != events[n] {
+			t.Errorf("#%d: got=%v want=%v", n, e["event"], events[n])
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// manifestFile describes a single output file in the -manifest JSON document
+type manifestFile struct {
+	File  string `json:"file"`
+	Rows  uint   `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// writeManifest writes every finished output file with its row count & byte size to w
+func writeManifest(w io.Writer, files []*outputFile) error {
+	list := make([]manifestFile, len(files))
+	var rows uint
+	for i, f := range files {
+		list[i] = manifestFile{File: f.name, Rows: f.rows, Bytes: f.bytes.n}
+		rows += f.rows
+	}
+
+	b, err := json.MarshalIndent(map[string]interface{}{"files": list, "rows": rows}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
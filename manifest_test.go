@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteManifest(t *testing.T) {
+	files := []*outputFile{
+		{name: "a.csv", rows: 2, bytes: &countingOutput{n: 10}},
+		{name: "b.csv", rows: 3, bytes: &countingOutput{n: 15}},
+	}
+
+	b := &bytes.Buffer{}
+	if err := writeManifest(b, files); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := `{
+  "files": [
+    {
+      "file": "a.csv",
+      "rows": 2,
+      "bytes": 10
+    },
+    {
+      "file": "b.csv",
+      "rows": 3,
+      "bytes": 15
+    }
+  ],
+  "rows": 5
+}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got=%s want=%s", got, want)
+	}
+}
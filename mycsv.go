@@ -1,49 +1,203 @@
 package main
 
 import (
+	"context"
+	"crypto/sha1"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"golang.org/x/crypto/ssh/terminal"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 const (
-	// Amount of CSV write data to buffer between flushes.
-	flushBufferSize = 26214400 // 25MB
+	// Default amount of CSV write data to buffer between flushes.
+	defaultBufferSize = 25 // MB
 
 	// Timeout length where ctrl+c is ignored.
 	signalTimeout = 3 // Seconds
 
-	// Timeout length to wait for a query string sent via stdin.
-	stdinTimeout = 10 // Milliseconds
+	// Exit code when output cannot be written, matches EX_IOERR from sysexits.h.
+	exitWriteError = 74
+
+	// Exit code when -skip-empty-file removed the output of a query that returned no rows.
+	exitEmptyResult = 3
+
+	// Exit code when -max-runtime stopped the export, matches timeout(1).
+	exitTimedOut = 124
+
+	// Exit code for errors mycsv does not expect, matches a Go panic.
+	exitInternalError = 2
+
+	// Exit code when the database cannot be connected to, matches EX_UNAVAILABLE from sysexits.h.
+	exitConnectError = 69
+
+	// Exit code when the query fails or its results cannot be read, matches EX_DATAERR from sysexits.h.
+	exitQueryError = 65
 )
 
 type (
 	// dbInfo contains information necessary to connect to a database
 	dbInfo struct {
-		user    string
-		pass    string
-		host    string
-		port    string
-		charset string
-		tls     bool
+		user        string
+		pass        string
+		host        string
+		port        string
+		socket      string
+		timeout     time.Duration
+		readTimeout time.Duration
+		charset     string
+		tls         bool
+		tlsConfig   string
+		tlsCA       string
+		tlsCert     string
+		tlsKey      string
+		tlsSkip     bool
+		parseTime   bool
+		loc         string
+		timeZone    string
+		network     string
+		initCmd     string
+		driver      string
+	}
+
+	// exportInfo contains information necessary to read and write query results
+	exportInfo struct {
+		query     string
+		header    bool
+		appending bool
+		verbose   bool
+		format    string
+		table     string
+		batch     int
+		sample    int
+		htmlClass string
+
+		explodeDir     string
+		explodeName    string
+		explodeContent string
+
+		delimiter   string
+		quote       string
+		escape      string
+		terminator  string
+		prefix      string
+		suffix      string
+		newline     string
+		replace     string
+		nullString  string
+		flushSize   int
+		trim        bool
+		trimCols    []string
+		colsCase    bool
+		geometry    string
+		binary      string
+		keepalive   time.Duration
+		print0      bool
+		verify      bool
+		addHost     bool
+		addDB       bool
+		addQuery    bool
+		host        string
+		database    sql.RawBytes
+		throttle    int
+		warnings    bool
+		compress    string
+		rowBuffer   int
+		schema      io.WriteCloser
+		cost        bool
+		rotate      *rotatingOutput
+		outputs     []*outputFile
+		progress    *progressWriter
+		headerOut   io.WriteCloser
+		dedup       bool
+		hash        string
+		hashColumn  string
+		previous    map[string]struct{}
+		sqlldr      io.WriteCloser
+		ctlTable    string
+		ctlInfile   string
+		sortCol     string
+		sortDesc    bool
+		sortMax     int
+		reverse     bool
+		reverseMax  int
+		countLine   bool
+		pageSize    int
+		orderKey    string
+		lockRetries int
+		trimFinal   bool
+		profile     bool
+		typecheck   int
+		maxCols     int
+		ctx         context.Context // Cancels the query when -max-runtime is reached
+		floatFmt    string
+		boolFmt     string
+		numberFmt   string
+		nullIf      [][]byte
+		nullFold    bool
+		pads        []padSpec
+		doubleQuote bool
+		rfc4180     bool
+
+		unpivotKeys     []string
+		unpivotMeasures []string
+		coalesceName    string
+		coalesceSources []string
+		coalesceDrop    bool
+	}
+
+	// column describes a single query result column
+	column struct {
+		name   string
+		dbType string          // MySQL type name reported by the driver, TEXT if unknown
+		info   *sql.ColumnType // Full driver type information, nil if unavailable
+	}
+
+	// recordWriter is implemented by each output format
+	recordWriter interface {
+		WriteHeader(cols []sql.RawBytes) (int, error)
+		Write(record []sql.RawBytes) (int, error)
+		Flush()
+		Close() error
+		Error() error
 	}
 )
 
 // Version information supplied by build script
 var versionInformation string
 
+// watchStop is closed by the signal handler to end -watch after the current export
+var watchStop chan struct{}
+
+// runtimeExceeded is set by readRows when -max-runtime ends an export early, it is read once
+// the export has finished
+var runtimeExceeded bool
+
+// panicOnError makes fatal errors panic with a stack trace for debugging, it is set by -v
+var panicOnError bool
+
+// cleanups are run by runCleanups before mycsv exits, os.Exit skips deferred calls
+var cleanups []func()
+
 // ShowUsage prints a help screen
 func showUsage() {
 	fmt.Printf("\tmycsv version %s\n", versionInformation)
@@ -53,29 +207,128 @@ func showUsage() {
 
 	EXAMPLES:
 	mycsv -user=jprunier -pass= -file=my.csv -charset=utf8 -query="select * from jjp.example_table where filter in ('1', 'test', 'another')"
+	mycsv -user=jprunier -pass= -file=my.csv "select * from mysql.plugin"
 	echo "select * from mysql.plugin" | mycsv -user=jprunier -pass=mypass -host=remotedb > my.csv
 	mycsv -user=jprunier -pass= -file=my.csv -d="|" -q="'" < queryfile
 
 	DATABASE FLAGS
 	==============
+	-driver: Database driver, mysql or postgres. Postgres connects to the database named after -user on port 5432 unless -port is given, -tls sets sslmode=require and -charset the client_encoding. Type based flags such as -binary-encoding match MySQL type names ("mysql" default)
 	-user: Database Username (required)
 	-pass: Database Password (interactive prompt if blank)
+	-pass-fd: Read the database password from an inherited file descriptor such as 3, one trailing newline is removed
+	-prompt: Text of the interactive password prompt, written to stderr ("Enter password: " default)
 	-host: Database Host (localhost assumed if blank)
 	-port: Database Port (3306 default)
+	-socket: Connect over the MySQL server's unix socket at this path, such as /var/run/mysqld/mysqld.sock, instead of TCP. -host and -port are ignored (disabled default)
+	-timeout: Seconds to wait when connecting, 0 waits forever (30 default)
+	-read-timeout: Seconds to wait for each network read & write once connected, a query that runs longer than this before returning its first row, or between rows, fails (0 default, waits forever)
 	-charset: Database character set (binary default)
-	-tls: Use TLS, also enables cleartext passwords (default false)
+	-tls: Use TLS, also enables cleartext passwords. The server certificate is only verified with -ca, -cert or -tls-pin (default false)
+	-init-command: Statement run on every new database connection before it is used, such as SET SESSION sql_mode='ANSI'
+	-socks5: Connect to the database through the SOCKS5 proxy at host:port, -host is resolved by the proxy
+	-socks5-user: SOCKS5 proxy username (no authentication default)
+	-socks5-pass: SOCKS5 proxy password
+	-tls-pin: Only connect to a server whose certificate has this SHA-256 fingerprint, e.g. sha256:9f86d081... as printed by openssl x509 -fingerprint -sha256. Implies -tls and replaces CA & host name verification, mysql driver only (disabled default)
+	-ca: PEM file of the CA certificates the server certificate must be signed by, the certificate must also match -host. Implies -tls (disabled default)
+	-cert: PEM file of a client certificate to present to the server, requires -key. Implies -tls and verifies the server against the system CAs unless -ca is given (disabled default)
+	-key: PEM file of the -cert private key
+	-tls-skip-verify: Use TLS without verifying the server certificate, the -tls behavior made explicit. Implies -tls (false default)
+	-parse-time: Parse DATETIME & TIMESTAMP values in the driver and write them in RFC 3339 format, e.g. 2017-01-01T15:04:05Z (false default)
+	-loc: Time zone DATETIME & TIMESTAMP values are assumed to be in when -parse-time is set, the RFC 3339 offset is taken from it (UTC default)
+	-time-zone: Session time_zone such as +00:00 or Europe/London, the server converts TIMESTAMP values to it before sending them. Set -loc to the same zone with -parse-time for consistent offsets (server default)
+	-keepalive: Ping the server at this interval while waiting for the first row, e.g. 30s (0 default, disabled)
+	-max-runtime: Stop the export once mycsv has run this long such as 30m, the rows read so far are written, the output is closed as normal and mycsv exits with code 124. The output is left empty if the query had not returned rows yet (0 default, no limit)
+	-max-execution-time: Milliseconds before the server aborts the query, MySQL 5.7.8+ (0 default, no limit)
 
 
 	CSV FLAGS
 	=========
-	-file: CSV output filename (Write to stdout if not supplied)
-	-query: MySQL query (required, can be sent via stdin redirection)
+	-file: CSV output filename, gs://bucket/object or s3://bucket/key (Write to stdout if not supplied)
+	-query: MySQL query, a select, with, show, desc, describe or explain statement (required, can be given as the last argument or sent via stdin redirection)
+	-query-dir: Directory of .sql files to export, -file is used as the output directory (current directory default)
 	-header: Print initial column name header line (true default)
-	-d: CSV field delimiter ("," default)
-	-q: CSV quote character ("\"" default)
-	-e: CSV escape character ("\\" default)
+	-max-cols: Write only the first K columns of the query results, e.g. to preview a select * from a wide table. Every column is still read from the server, -row-hash covers the written columns (0 default, all columns)
+	-row-hash: Append a column holding an xxhash or sha1 hash of each row's values as read from the database, before trimming or encoding (disabled default)
+	-row-hash-column: Header name of the -row-hash column ("row_hash" default)
+	-diff-against: Only write rows whose -row-hash is not in this previous CSV export of the query. The previous hashes are held in memory, roughly 70 bytes per xxhash row or 90 per sha1 row
+	-dedup-headers: Rename repeated column names with a numeric suffix so id, id becomes id, id_2 (false default)
+	-header-file: Write the header line to this file and only rows to the output, csv format only
+	-d: CSV field delimiter, may be several characters such as || for loaders that need an unambiguous separator. Without a quote character a field that ends with part of the delimiter can run into it ("," default)
+	-q: CSV quote character, may be several characters ("\"" default)
+	-e: CSV escape character, may be several characters ("\\" default)
 	-t: CSV line terminator ("\n" default)
-	-v: Print more information (false default)
+	-dialect: Write CSV a target database reads, clickhouse writes quotes within fields doubled instead of escaped and newlines, NUL bytes & backslashes as is for ClickHouse's CSVWithNames format, NULL stays an unquoted \N. Requires csv format, the header line and a quote character and -e can not be set (disabled default)
+	-rfc4180: Write CSV as RFC 4180 describes for Excel, pandas and other standard CSV readers instead of MySQL style. Quotes within fields are doubled, newlines & backslashes are written as is, NULL is an empty unquoted field and lines end with CRLF unless -t is given. Requires csv format and a quote character and -e can not be set (false default)
+	-line-prefix: Written before each data line, not the header
+	-line-suffix: Written after each data line before the terminator, not the header
+	-replace-delimiter: Replace delimiters inside fields with this character instead of quoting or escaping them. This changes the exported data and can not be reversed (disabled default)
+	-normalize-newlines: Convert CR, LF & CRLF within fields to a single style, lf, crlf or cr (disabled default)
+	-geometry: Spatial column output, raw or wkt ("raw" default)
+	-float-format: Format DECIMAL, FLOAT & DOUBLE values with a Go fmt floating point verb, .2f after a percent sign keeps 2 decimal places. Values are parsed as 64 bit floats so DECIMAL values beyond 15 significant digits lose precision (disabled default)
+	-null: Write NULL as this unquoted value such as -null= or -null=NULL, csv format only. Values equal to it are still quoted so they stay distinct unless -q is empty (escape character followed by N default, empty with -rfc4180)
+	-null-if: Write fields equal to this value as NULL instead, may be repeated such as -null-if=N/A -null-if=-. Values are compared as read after any trimming (disabled default)
+	-null-if-case-insensitive: Match -null-if values ignoring case, so -null-if=null also matches NULL and Null (false default)
+	-number-format: Comma thousands separators, strip or group. strip removes them from any value that is a grouped number such as FORMAT(n, 2) returns, group adds them to the integer part of numeric column values, e.g. 1234567.5 becomes 1,234,567.5. The decimal point is never changed (disabled default)
+	-pad: Pad a column's values to a width, col:width:align where align is left, right or zero, may be repeated such as -pad=id:8:zero -pad=name:20:left. Width counts characters so UTF-8 values line up, longer values are not truncated, NULLs are not padded and zero pads after any sign. Applied after the other conversions (disabled default)
+	-bool-format: BIT column output, 01, truefalse or yn. Values other than 0 & 1 from wider BIT columns are written as integers. The driver reports TINYINT(1) as TINYINT so those columns are left as 0 & 1 (raw bytes default)
+	-binary-encoding: Binary column output, raw, hex or base64 ("raw" default)
+	-raw: Write the bytes of a single column query verbatim followed by the terminator with no header, quoting or escaping, e.g. to extract blobs (false default)
+	-explode: Write the content column of each row of a two column query to its own file named by the name column, e.g. -explode=filename=data -file=out_dir. -file is the directory, created if missing, and the bytes are written verbatim. Characters not allowed in file names are replaced by _, repeated or existing names get a numeric suffix such as a_2.png and NULL or empty names are named row_N (disabled default)
+	-trim-final-newline-stdout: Omit the terminator after the last record when writing csv to stdout, for consumers that read a trailing terminator as an empty record. Files always end with a terminator (false default)
+	-print0: Terminate lines with NUL and disable quoting for xargs -0 style consumers (false default)
+	-unpivot: Write each row once per measure column with the key columns followed by metric_name & metric_value columns, e.g. keys=id,day;measures=clicks,views. A row with 3 measures becomes 3 rows, row counts, -verify and -manifest count the unpivoted rows (disabled default)
+	-coalesce: Add a column holding the first non NULL value of a list of columns, like COALESCE() in the query, e.g. phone=mobile,home,work. The new column is written after the query's columns and is NULL when every source is (disabled default)
+	-coalesce-drop: Leave the -coalesce source columns out of the output, the new column may then reuse a source's name (false default)
+	-sort-output: Buffer every row and write them sorted by this column, numeric columns are compared by value. All rows are held in memory, use ORDER BY in the query when possible
+	-sort-desc: Sort -sort-output in descending order (false default)
+	-sort-max-rows: Maximum rows -sort-output will buffer before failing (1000000 default)
+	-reverse: Buffer every row and write them last first after the query completes, the header stays first. All rows are held in memory, use ORDER BY ... DESC in the query when possible (false default)
+	-reverse-max-rows: Maximum rows -reverse will buffer before failing (1000000 default)
+	-watch: Re-run the query this many seconds after each run finishes and append the new output without repeating the header. A confirmed ctrl+c stops after the running export (0 default, run once)
+	-page-size: Fetch rows in pages of this many using a separate short query for each, so no single query holds locks or server buffers for the whole export. Rows are written in -order-key order (0 default, a single query)
+	-order-key: Column -page-size pages are ordered by, it must be unique and never NULL or rows will be skipped or repeated. Each page is selected from the query as a derived table, an index on the key keeps pages fast
+	-lock-retries: Times a -page-size export resumes from the last key after a lock wait timeout (1205) or deadlock (1213), exports without -page-size fail on these errors (3 default)
+	-throttle: Maximum rows written per second to limit load on the server (0 default, unlimited)
+	-rotate-interval: Start a new output file every interval such as 1h, the interval start time is added to each file name (disabled default)
+	-split: Start a new output file every N rows, files are numbered out.000.csv, out.001.csv and so on with a header in each (disabled default)
+	-split-bytes: Start a new numbered output file once the current one reaches this many bytes before compression, a file ends with the row that reaches the size (disabled default)
+	-compress: Compress output, none, gzip or bgzip. An output file ending in .gz is gzip compressed unless -compress is given, standard out is only compressed when it is. bgzip also writes a .gzi index next to the output file ("none" default)
+	-buffer: Megabytes of CSV output to buffer between writes (25 default)
+	-row-buffer: Rows to buffer between reading & writing, rows are copied so the reader never waits on the writer (0 default, rows are handed off one at a time)
+	-format: Output format, csv, sql, table, lenprefix or html. lenprefix writes a 4 byte big endian field count per record and a 4 byte length before each field, NULL has length 0xFFFFFFFF. html writes a table with escaped values and NULLs as empty cells with class="null", rows are streamed as they are read ("csv" default)
+	-table: Table name used in INSERT statements (required for sql format)
+	-batch-insert: Number of rows per INSERT statement for sql format (1 default)
+	-table-sample: Number of rows used to size columns for table format (1000 default)
+	-html-class: Class attribute of the html format table element for styling
+	-trim: Strip leading & trailing whitespace from every field, alters data (false default)
+	-trim-cols: Comma separated columns to strip leading & trailing whitespace from
+	-case-sensitive-cols: Match column names given to flags case sensitively (false default)
+	-bundle: Write the data, query, schema JSON and run report to a single archive, a .zip file name writes a zip archive and anything else a .tar.gz. The archive is created once the connection and any -precheck succeed and is left empty if the export then fails
+	-report: Write a JSON report with the start & end time, duration, rows, bytes, output files, query hash and exit status. A partial report is written if the export fails or is interrupted
+	-syslog: Log an audit message to syslog when the export starts and finishes with the database user & host, query hash, destination, status, exit code & row count. Failed exports are logged at error severity, windows is not supported and only warns (false default)
+	-syslog-addr: Remote syslog server for -syslog, host:port for UDP or tcp://host:port (local syslog default)
+	-manifest: Write a JSON file listing every output file created with its row count and size in bytes
+	-sqlldr: Write an Oracle SQL*Loader control file loading the output into this table next to the output file, my.csv writes my.ctl. SQL*Loader does not remove escape characters
+	-schema-file: Write the name, type, nullability, length and precision/scale of each column to a JSON file
+	-precheck: Select run before exporting, mycsv exits without creating output if it returns no rows or a first value of 0, false or empty
+	-count-header: Count the query's rows with SELECT COUNT(*) FROM (query) before exporting and write the count first, line writes it as the first line of the output and file writes it to a .count file next to the output such as my.csv.count. The query effectively runs twice and rows changed in between make the count differ, a warning is printed if it does (disabled default)
+	-count-only: Print the number of rows the query returns and exit without exporting. select * from table queries use the approximate information_schema count (false default)
+	-exact: Count every row of a select * from table query for -count-only (false default)
+	-cost: Print the estimated query cost and rows from EXPLAIN FORMAT=JSON before exporting (false default)
+	-show-warnings: Print warnings raised by the query to stderr after it completes (false default)
+	-typecheck: Check the first N rows as read against each column's declared type and warn about integer, decimal, float, date & time columns with values that do not parse, output is not changed (0 default, disabled)
+	-profile: Print each column's non NULL count, minimum & maximum length in bytes and approximate distinct count after the export. Distinct counts are HyperLogLog estimates using 16KB per column, typically within 1% (false default)
+	-skip-empty-file: Remove the output file, and the .gzi index of bgzip output, and exit with code 3 when the query returns no rows so no file means no data. Requires a local -file (false default)
+	-verify: Re-read the output file after writing and check the record count (false default)
+	-add-host-column: Prepend a source_host column with the database host & port (false default)
+	-add-db-column: Prepend a source_db column with the connection's current database (false default)
+	-add-query-column: Prepend a source_query column with the query text (false default)
+	-v: Print more information, errors also print a stack trace (false default)
+	-log-file: Write informational & verbose messages to a file instead of stderr
+	-log-json: Write informational & verbose messages as JSON events, implies -v (false default)
+	-config: Read flag values from a file of key=value lines such as host=db1, flags given on the command line take precedence. Double quoted values are read as Go strings so t="\r\n" is a CRLF, and repeatable flags such as -null-if take a line per value
+	-dump-config: Print the effective value of every flag once the config file is applied as key=value lines -config can read, then exit without connecting. The password is masked, so remove its line before reusing the output, values with control characters such as the terminator are written Go quoted and repeatable flags get a line per value (false default)
 
 	DEBUG FLAGS
 	===========
@@ -92,25 +345,125 @@ func main() {
 	// Database flags
 	dbUser := flag.String("user", "", "Database Username (required)")
 	dbPass := flag.String("pass", "", "Database Password (interactive prompt if blank)")
+	dbPassFD := flag.Int("pass-fd", -1, "Read the database password from an inherited file descriptor")
+	passPrompt := flag.String("prompt", "Enter password: ", "Text of the interactive password prompt")
 	dbHost := flag.String("host", "", "Database Host (localhost assumed if blank)")
+	dbDriver := flag.String("driver", "mysql", "Database driver, mysql or postgres")
 	dbPort := flag.String("port", "3306", "Database Port")
+	dbSocket := flag.String("socket", "", "Connect over the unix socket at this path instead of TCP")
+	dbTimeout := flag.Int("timeout", 30, "Seconds to wait when connecting, 0 waits forever")
+	dbReadTimeout := flag.Int("read-timeout", 0, "Seconds to wait for each network read & write once connected, 0 waits forever")
 	dbCharset := flag.String("charset", "binary", "Database character set")
 	dbTLS := flag.Bool("tls", false, "Enable TLS & cleartext passwords")
+	tlsPin := flag.String("tls-pin", "", "Only accept a server certificate with this fingerprint, sha256:hex")
+	tlsCA := flag.String("ca", "", "PEM file of CA certificates the server certificate is verified against")
+	tlsCert := flag.String("cert", "", "PEM file of the client certificate presented to the server")
+	tlsKey := flag.String("key", "", "PEM file of the client certificate's private key")
+	tlsSkip := flag.Bool("tls-skip-verify", false, "Use TLS without verifying the server certificate")
+	socksAddr := flag.String("socks5", "", "Connect through the SOCKS5 proxy at host:port")
+	socksUser := flag.String("socks5-user", "", "SOCKS5 proxy username")
+	socksPass := flag.String("socks5-pass", "", "SOCKS5 proxy password")
+	dbInitCmd := flag.String("init-command", "", "Statement run on every new database connection")
+	dbParseTime := flag.Bool("parse-time", false, "Have the driver parse DATETIME & TIMESTAMP values and write them as RFC 3339")
+	dbLoc := flag.String("loc", "UTC", "Time zone used to interpret DATETIME & TIMESTAMP values with -parse-time")
+	dbTimeZone := flag.String("time-zone", "", "Session time_zone the server converts TIMESTAMP values to")
+	maxRuntime := flag.Duration("max-runtime", 0, "Stop the export and exit with code 124 after this long, e.g. 30m")
+	dbKeepalive := flag.Duration("keepalive", 0, "Ping interval while waiting for the first row")
+	maxExecTime := flag.Int("max-execution-time", 0, "Milliseconds before the server aborts the query")
 
 	// CSV formatting flags
-	csvFile := flag.String("file", "", "CSV output filename")
+	csvFile := flag.String("file", "", "CSV output filename, gs://bucket/object or s3://bucket/key")
 	csvQuery := flag.String("query", "", "MySQL query")
+	queryDir := flag.String("query-dir", "", "Directory of .sql files to export, one output file per query")
 	csvHeader := flag.Bool("header", true, "Print initial column name header line")
+	maxCols := flag.Int("max-cols", 0, "Write only the first K columns of the query results")
 	csvDelimiter := flag.String("d", `,`, "CSV field delimiter")
 	csvQuote := flag.String("q", `"`, "CSV quote character")
 	csvEscape := flag.String("e", `\`, "CSV escape character")
 	csvTerminator := flag.String("t", "\n", "CSV line terminator")
+	csvPrefix := flag.String("line-prefix", "", "Written before each data line")
+	csvSuffix := flag.String("line-suffix", "", "Written after each data line, before the terminator")
+	csvReplace := flag.String("replace-delimiter", "", "Replace delimiters within fields with this character instead of escaping them")
+	csvNewlines := flag.String("normalize-newlines", "", "Convert CR, LF & CRLF within fields to one style, lf, crlf or cr")
+	csvRFC4180 := flag.Bool("rfc4180", false, "Write RFC 4180 CSV with doubled quotes and NULL as an empty field")
+	csvDialect := flag.String("dialect", "", "Check the CSV format suits a target database and double quotes, clickhouse")
+	csvGeometry := flag.String("geometry", "raw", "Spatial column output, raw or wkt")
+	csvFloatFmt := flag.String("float-format", "", "Format DECIMAL, FLOAT & DOUBLE values with a fmt verb such as %.2f")
+	csvNumberFmt := flag.String("number-format", "", "Thousands separators, strip or group")
+	var csvPads listFlag
+	flag.Var(&csvPads, "pad", "Pad a column's values to a width, col:width:align, may be repeated")
+	csvBoolFmt := flag.String("bool-format", "", "BIT column output, 01, truefalse or yn")
+	csvNull := flag.String("null", "", "Write NULL as this unquoted value (escape character followed by N if not given)")
+	var csvNullIf listFlag
+	flag.Var(&csvNullIf, "null-if", "Write fields equal to this value as NULL, may be repeated")
+	csvNullFold := flag.Bool("null-if-case-insensitive", false, "Match -null-if values ignoring case")
+	csvBinary := flag.String("binary-encoding", "raw", "Binary column output, raw, hex or base64")
+	csvRaw := flag.Bool("raw", false, "Write a single column's bytes verbatim followed by the terminator")
+	csvExplode := flag.String("explode", "", "Write each row's content column to a file named by its name column, name-col=content-col")
+	trimFinal := flag.Bool("trim-final-newline-stdout", false, "Omit the terminator after the last record when writing to stdout")
+	csvPrint0 := flag.Bool("print0", false, "Terminate lines with NUL and disable quoting")
+	csvThrottle := flag.Int("throttle", 0, "Maximum rows written per second")
+	csvUnpivot := flag.String("unpivot", "", "Write a row per measure column, keys=col1,col2;measures=m1,m2")
+	csvCoalesce := flag.String("coalesce", "", "Add a column holding the first non NULL value of other columns, name=col1,col2")
+	coalesceDrop := flag.Bool("coalesce-drop", false, "Leave the -coalesce source columns out of the output")
+	csvReverse := flag.Bool("reverse", false, "Buffer all rows and write them last first")
+	reverseMax := flag.Int("reverse-max-rows", 1000000, "Maximum rows -reverse will buffer before failing")
+	sortCol := flag.String("sort-output", "", "Buffer all rows and write them sorted by this column")
+	sortDesc := flag.Bool("sort-desc", false, "Sort -sort-output in descending order")
+	sortMax := flag.Int("sort-max-rows", 1000000, "Maximum rows buffered by -sort-output")
+	csvRotate := flag.Duration("rotate-interval", 0, "Start a new timestamped output file every interval")
+	csvSplit := flag.Uint("split", 0, "Start a new numbered output file every N rows")
+	csvSplitBytes := flag.Int64("split-bytes", 0, "Start a new numbered output file once the current one reaches this many bytes")
+	csvCompress := flag.String("compress", "none", "Compress output, none, gzip or bgzip")
+	pageSize := flag.Int("page-size", 0, "Fetch rows in pages of this size ordered by -order-key")
+	orderKey := flag.String("order-key", "", "Unique, non NULL column -page-size pages are ordered by")
+	lockRetries := flag.Int("lock-retries", 3, "Times a -page-size export resumes after a lock wait timeout or deadlock")
+	watchEvery := flag.Int("watch", 0, "Re-run the query this many seconds after each run, appending to the output")
+	rowBuffer := flag.Int("row-buffer", 0, "Rows to buffer between the reader & writer, each row is copied")
+	csvBuffer := flag.Int("buffer", defaultBufferSize, "Megabytes of CSV output to buffer between writes")
+	csvFormat := flag.String("format", "csv", "Output format, csv, sql, table, lenprefix or html")
+	sqlTable := flag.String("table", "", "Table name used in INSERT statements")
+	sqlBatch := flag.Int("batch-insert", 1, "Number of rows per INSERT statement")
+	tableSample := flag.Int("table-sample", 1000, "Number of rows used to size columns for table format")
+	htmlClass := flag.String("html-class", "", "Class attribute of the html format table")
+	csvTrim := flag.Bool("trim", false, "Strip leading & trailing whitespace from every field")
+	csvTrimCols := flag.String("trim-cols", "", "Comma separated columns to strip leading & trailing whitespace from")
+	csvDedup := flag.Bool("dedup-headers", false, "Rename repeated column names with a numeric suffix, id & id become id & id_2")
+	csvHash := flag.String("row-hash", "", "Append a hash of each row's values, xxhash or sha1")
+	csvHashColumn := flag.String("row-hash-column", "row_hash", "Header name of the -row-hash column")
+	csvDiff := flag.String("diff-against", "", "Only write rows whose hash is not in this previous export")
+	csvColsCase := flag.Bool("case-sensitive-cols", false, "Match column names given to flags case sensitively")
+	csvAddHost := flag.Bool("add-host-column", false, "Prepend a source_host column with the database host & port")
+	csvAddDB := flag.Bool("add-db-column", false, "Prepend a source_db column with the connection's current database")
+	csvAddQuery := flag.Bool("add-query-column", false, "Prepend a source_query column with the query text")
+	countHeader := flag.String("count-header", "", "Count the rows first and write the count as the first line or to a .count file, line or file")
+	countOnly := flag.Bool("count-only", false, "Print the number of rows the query returns and exit without exporting")
+	countExact := flag.Bool("exact", false, "Count single table queries exactly instead of using the information_schema estimate")
+	precheck := flag.String("precheck", "", "Select that must return a row with a true first value before exporting")
+	showCost := flag.Bool("cost", false, "Print the optimizer's estimated query cost & rows before exporting")
+	showWarn := flag.Bool("show-warnings", false, "Print warnings raised by the query to stderr after it completes")
+	headerFile := flag.String("header-file", "", "Write the header line to this file instead of the output")
+	reportFile := flag.String("report", "", "Write a JSON report of the run's timing, rows, bytes, files & status")
+	auditSyslog := flag.Bool("syslog", false, "Log an audit message to syslog when the export starts & finishes")
+	syslogAddr := flag.String("syslog-addr", "", "Remote syslog server for -syslog, host:port or tcp://host:port")
+	manifestFile := flag.String("manifest", "", "Write a JSON list of every output file with its row count & size")
+	schemaFile := flag.String("schema-file", "", "Write the query's column metadata to a JSON file")
+	sqlldrTable := flag.String("sqlldr", "", "Write a SQL*Loader control file that loads the output into this Oracle table")
+	typecheck := flag.Int("typecheck", 0, "Warn about columns whose values in the first N rows do not parse as their declared type")
+	csvProfile := flag.Bool("profile", false, "Print per column statistics after the export")
+	bundleFile := flag.String("bundle", "", "Write the data, schema, query and run report to a single .tar.gz or .zip archive")
+	skipEmpty := flag.Bool("skip-empty-file", false, "Remove the output file and exit with code 3 if the query returns no rows")
+	csvVerify := flag.Bool("verify", false, "Re-read the output file after writing and check the record count")
 	verbose := flag.Bool("v", false, "Print more information")
+	logJSON := flag.Bool("log-json", false, "Write informational & verbose messages as JSON events, implies -v")
+	logFile := flag.String("log-file", "", "Write informational & verbose messages to a file instead of stderr")
 
 	// Debug flags
 	cpuprofile := flag.String("debug_cpu", "", "CPU debugging filename")
 	memprofile := flag.String("debug_mem", "", "Memory debugging filename")
 	version := flag.Bool("version", false, "Version information")
+	configFile := flag.String("config", "", "Read flag values from a key=value file, command line flags take precedence")
+	dumpConfig := flag.Bool("dump-config", false, "Print the effective flag values and exit")
 
 	// Override default help
 	help := flag.Bool("help", false, "Show usage")
@@ -131,305 +484,2294 @@ func main() {
 		os.Exit(0)
 	}
 
-	// If query not provided read from standard in
-	var query string
-	queryChan := make(chan string)
-	defer close(queryChan)
-	if *csvQuery == "" {
-		go func() {
-			b, err := ioutil.ReadAll(os.Stdin)
-			checkErr(err)
+	// Fill in flags that were not given on the command line from the config file
+	if *configFile != "" {
+		if err := applyConfig(*configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
-			queryChan <- string(b)
-		}()
+	if *dumpConfig {
+		checkErr(writeConfig(os.Stdout, flag.CommandLine))
+		os.Exit(0)
+	}
 
-		select {
-		case q := <-queryChan:
-			query = q
-		case <-time.After(time.Millisecond * stdinTimeout):
-			fmt.Fprintln(os.Stderr, "You must supply a query")
+	// Send informational messages to a log file if supplied
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-	} else {
-		query = *csvQuery
+		defer f.Close()
+		logger.w = f
+	}
+
+	// Structured events replace the human readable verbose output, only -v itself turns on
+	// panicking for a stack trace
+	panicOnError = *verbose
+	if *logJSON {
+		logger.json = true
+		*verbose = true
 	}
 
-	// Make sure the query is a select
-	if strings.ToLower(query[0:6]) != "select" {
-		fmt.Fprintln(os.Stderr, "Query must be a select!")
+	// A terminal gets a status line rewritten in place, anything else a row of dots
+	logger.status = !*logJSON && *logFile == "" && terminal.IsTerminal(int(os.Stderr.Fd()))
+
+	// The query can follow the flags, flag parsing stops at the first argument so it must be last
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Only one query argument is allowed, quote the query and put it after every flag!")
 		os.Exit(1)
 	}
+	argQuery := flag.Arg(0)
 
-	// Create CSV output file if supplied, otherwise use standard out
-	var writeTo string
-	var writerDest io.Writer
-	var err error
-	if *csvFile == "" {
-		writeTo = "standard out"
-		writerDest = os.Stdout
-	} else {
-		f, err := os.Open(*csvFile)
-		if err == nil {
-			fmt.Fprintln(os.Stderr, *csvFile, "already exists!")
-			fmt.Fprintln(os.Stderr, "Please remove it or use a different filename")
+	// If query not provided read from standard in
+	var query string
+	if *queryDir != "" {
+		if *csvQuery != "" || argQuery != "" {
+			fmt.Fprintln(os.Stderr, "-query or a query argument and -query-dir cannot be used together!")
 			os.Exit(1)
 		}
-		f.Close()
-		writerDest, err = os.Create(*csvFile)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+	} else if *csvQuery != "" && argQuery != "" {
+		fmt.Fprintln(os.Stderr, "-query and a query argument cannot be used together!")
+		os.Exit(1)
+	} else if argQuery != "" {
+		query = argQuery
+	} else if *csvQuery == "" {
+		// A terminal is not a redirected query, reading it would wait for the user
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprintln(os.Stderr, "You must supply a query with -query, as the last argument or redirect it to stdin")
 			os.Exit(1)
 		}
-		writeTo = *csvFile
-	}
 
-	// Create a new CSV writer
-	CSVWriter := NewWriter(writerDest)
-	if *csvDelimiter == `\t` {
-		CSVWriter.Delimiter = "\t"
+		b, err := ioutil.ReadAll(os.Stdin)
+		checkErr(err)
+		query = string(b)
 	} else {
-		CSVWriter.Delimiter = *csvDelimiter
+		query = *csvQuery
 	}
-	CSVWriter.Quote = *csvQuote
-	CSVWriter.Escape = *csvEscape
 
-	// Need literal string check here to see all 4 bytes instead of 2 (ascii 13 & 10)
-	// Newline is default but check here in case it is manually passed in
-	if *csvTerminator == `\r\n` {
-		CSVWriter.Terminator = "\r\n"
-	} else if *csvTerminator == `\n` {
-		CSVWriter.Terminator = "\n"
-	} else {
-		CSVWriter.Terminator = *csvTerminator
+	// Make sure the query returns rows
+	if *queryDir == "" {
+		if err := validateQuery(query); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	}
 
-	if *verbose {
-		fmt.Println("CSV output will be written to", writeTo)
+	// Map the newline style to the characters written in place of embedded line breaks
+	newlines := map[string]string{"": "", "lf": "\n", "crlf": "\r\n", "cr": "\r"}
+	newline, ok := newlines[*csvNewlines]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Newline style must be lf, crlf or cr!")
+		os.Exit(1)
 	}
 
-	// Check if Stdin has been redirected and reset so the user can be prompted for a password
-	checkStdin()
-
-	// Catch signals
-	catchNotifications()
+	// Features built on MySQL syntax, session variables or the MySQL driver are not available for Postgres
+	switch *dbDriver {
+	case "mysql":
+	case "postgres":
+		if *dbParseTime || *dbTimeZone != "" || *maxExecTime != 0 || *dbReadTimeout != 0 || *socksAddr != "" || *tlsPin != "" || *dbSocket != "" {
+			fmt.Fprintln(os.Stderr, "-parse-time, -time-zone, -max-execution-time, -read-timeout, -socks5, -tls-pin and -socket are not supported with -driver=postgres!")
+			os.Exit(1)
+		}
+		if *showWarn || *showCost || *countOnly || *countHeader != "" || *pageSize != 0 {
+			fmt.Fprintln(os.Stderr, "-show-warnings, -cost, -count-only, -count-header and -page-size are not supported with -driver=postgres!")
+			os.Exit(1)
+		}
 
-	// CPU Profiling
-	if *cpuprofile != "" {
-		f, err := os.Create(*cpuprofile)
-		checkErr(err)
-		pprof.StartCPUProfile(f)
-		defer pprof.StopCPUProfile()
+		portSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "port" {
+				portSet = true
+			}
+		})
+		if !portSet {
+			*dbPort = postgresPort
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown driver", *dbDriver)
+		os.Exit(1)
 	}
 
-	// Default to localhost if no host or socket provided
-	if *dbHost == "" {
-		*dbHost = "127.0.0.1"
+	// RFC 4180 output is read by standard CSV readers rather than MySQL
+	doubleQuote := false
+	if *csvRFC4180 {
+		escapeSet, terminatorSet := false, false
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "e":
+				escapeSet = true
+			case "t":
+				terminatorSet = true
+			}
+		})
+		if *csvDialect != "" || escapeSet || *csvPrint0 || *csvRaw || *csvFormat != "csv" || *csvQuote == "" || *sqlldrTable != "" {
+			fmt.Fprintln(os.Stderr, "-rfc4180 requires csv format and a quote character and can not be used with -dialect, -e, -print0, -raw or -sqlldr!")
+			os.Exit(1)
+		}
+		if !terminatorSet {
+			*csvTerminator = "\r\n"
+		}
+		doubleQuote = true
 	}
 
-	// Need to provide a target
-	if *dbUser == "" {
-		fmt.Fprintln(os.Stderr, "You must provide a user name!")
+	// A dialect checks the CSV format suits the target database, the defaults already do
+	switch *csvDialect {
+	case "":
+	case "clickhouse":
+		// CSVWithNames reads doubled quotes, literal newlines within quotes and an unquoted \N as NULL
+		escapeSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "e" {
+				escapeSet = true
+			}
+		})
+		if escapeSet || *csvPrint0 || *csvRaw || !*csvHeader || *headerFile != "" || *csvFormat != "csv" || *csvQuote == "" {
+			fmt.Fprintln(os.Stderr, "-dialect=clickhouse requires csv format, a header line and a quote character and can not be used with -e, -print0 or -header-file!")
+			os.Exit(1)
+		}
+		doubleQuote = true
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown dialect", *csvDialect)
 		os.Exit(1)
 	}
 
-	// If password is blank prompt user
-	if *dbPass == "" {
-		fmt.Println("Enter password: ")
-		pwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	// A replacement that is itself special would make the output ambiguous
+	if *csvReplace != "" {
+		err := checkReplacement(decodeEscapes(*csvReplace), decodeEscapes(*csvDelimiter), *csvQuote, *csvEscape, decodeEscapes(*csvTerminator))
 		if err != nil {
-			if err != io.EOF {
-				checkErr(err)
-			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-		*dbPass = string(pwd)
 	}
 
-	// Populate dbInfo struct with flag values
-	dbi := dbInfo{user: *dbUser, pass: *dbPass, host: *dbHost, port: *dbPort, charset: *dbCharset, tls: *dbTLS}
+	var pin []byte
+	if *tlsPin != "" {
+		var err error
+		pin, err = parsePin(*tlsPin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *tlsCA != "" || *tlsCert != "" || *tlsSkip {
+			fmt.Fprintln(os.Stderr, "-tls-pin can not be used with -ca, -cert or -tls-skip-verify!")
+			os.Exit(1)
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "-cert and -key must be used together!")
+		os.Exit(1)
+	}
+	if *tlsCA != "" && *tlsSkip {
+		fmt.Fprintln(os.Stderr, "-ca verifies the server certificate, it can not be used with -tls-skip-verify!")
+		os.Exit(1)
+	}
 
-	// Create a *sql.DB connection to the source database
-	db, err := dbi.connect()
-	defer db.Close()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if _, err := time.LoadLocation(*dbLoc); err != nil {
+		fmt.Fprintln(os.Stderr, "Unknown location", *dbLoc)
 		os.Exit(1)
 	}
 
-	// Create channels
-	dataChan := make(chan []sql.RawBytes)
-	quitChan := make(chan bool)
-	goChan := make(chan bool)
+	switch *csvHash {
+	case "", "xxhash", "sha1":
+	default:
+		fmt.Fprintln(os.Stderr, "Row hash must be xxhash or sha1!")
+		os.Exit(1)
+	}
 
-	// Start reading & writing
-	go readRows(db, query, dataChan, quitChan, goChan, *csvHeader)
-	rowCount := writeCSV(CSVWriter, dataChan, goChan, *verbose)
+	// Previous hashes are loaded before the output is created in case it is the same file
+	var previous map[string]struct{}
+	if *csvDiff != "" {
+		if *csvHash == "" || *csvFormat != "csv" || *queryDir != "" {
+			fmt.Fprintln(os.Stderr, "-diff-against requires -row-hash, csv format and a single query!")
+			os.Exit(1)
+		}
 
-	// Block on quitChan until readRows() completes
-	<-quitChan
-	close(quitChan)
-	close(goChan)
+		prev := exportInfo{delimiter: decodeEscapes(*csvDelimiter), quote: *csvQuote, escape: *csvEscape, terminator: decodeEscapes(*csvTerminator), doubleQuote: doubleQuote, hashColumn: *csvHashColumn}
+		if *csvPrint0 {
+			prev.terminator = "\x00"
+			prev.quote = ""
+		}
 
-	// Memory Profiling
-	if *memprofile != "" {
-		f, err := os.Create(*memprofile)
-		checkErr(err)
-		pprof.WriteHeapProfile(f)
-		defer f.Close()
+		var err error
+		previous, err = prev.loadHashes(*csvDiff)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not read -diff-against file:", err)
+			os.Exit(1)
+		}
+		if *verbose {
+			logger.Printf("%d row hashes read from %s\n", len(previous), *csvDiff)
+		}
 	}
 
-	if *verbose {
-		fmt.Println()
-		fmt.Println(rowCount, "rows written")
-		fmt.Println("Total runtime =", time.Since(start))
+	if *csvGeometry != "raw" && *csvGeometry != "wkt" {
+		fmt.Fprintln(os.Stderr, "Geometry output must be raw or wkt!")
+		os.Exit(1)
 	}
-}
 
-// Pass the buck error catching
-func checkErr(e error) {
-	if e != nil {
-		log.Panic(e)
+	if *csvFloatFmt != "" && strings.Contains(fmt.Sprintf(*csvFloatFmt, 1.5), "%!") {
+		fmt.Fprintf(os.Stderr, "Float format must contain a single floating point verb such as %s!\n", "%.2f")
+		os.Exit(1)
 	}
-}
-
-// Catch signals
-func catchNotifications() {
-	state, err := terminal.GetState(int(os.Stdin.Fd()))
-	checkErr(err)
 
-	// Deal with SIGINT
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	if *maxCols < 0 {
+		fmt.Fprintln(os.Stderr, "Max columns can not be negative!")
+		os.Exit(1)
+	}
 
-	var timer time.Time
-	go func() {
-		for sig := range sigChan {
-			// Prevent exiting on accidental signal send
-			if time.Now().Sub(timer) < time.Second*signalTimeout {
-				terminal.Restore(int(os.Stdin.Fd()), state)
-				os.Exit(0)
-			}
+	if *typecheck < 0 {
+		fmt.Fprintln(os.Stderr, "Type check rows can not be negative!")
+		os.Exit(1)
+	}
 
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, sig, "signal caught!")
-			fmt.Fprintf(os.Stderr, "Send signal again within %v seconds to exit\n", signalTimeout)
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "")
+	if *syslogAddr != "" && !*auditSyslog {
+		fmt.Fprintln(os.Stderr, "-syslog-addr requires -syslog!")
+		os.Exit(1)
+	}
 
-			timer = time.Now()
+	nullSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "null" {
+			nullSet = true
 		}
-	}()
-}
-
-// Create and return a database handle
-func (dbi *dbInfo) connect() (*sql.DB, error) {
-	// Set MySQL driver parameters
-	dbParameters := "charset=" + dbi.charset
+	})
+	if nullSet && (*csvFormat != "csv" || *csvRaw) {
+		fmt.Fprintln(os.Stderr, "-null requires csv format!")
+		os.Exit(1)
+	}
 
-	// Append cleartext and tls parameters if TLS is specified
-	if dbi.tls == true {
-		dbParameters = dbParameters + "&allowCleartextPasswords=1&tls=skip-verify"
+	if *csvNullFold && len(csvNullIf) == 0 {
+		fmt.Fprintln(os.Stderr, "-null-if-case-insensitive requires -null-if!")
+		os.Exit(1)
 	}
 
-	db, err := sql.Open("mysql", dbi.user+":"+dbi.pass+"@tcp("+dbi.host+":"+dbi.port+")/?"+dbParameters)
-	checkErr(err)
+	switch *csvNumberFmt {
+	case "", "strip", "group":
+	default:
+		fmt.Fprintln(os.Stderr, "Number format must be strip or group!")
+		os.Exit(1)
+	}
 
-	// Ping database to verify credentials
-	err = db.Ping()
+	var pads []padSpec
+	for _, spec := range csvPads {
+		p, err := parsePad(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pads = append(pads, p)
+	}
 
-	return db, err
-}
+	if _, ok := boolFormats[*csvBoolFmt]; *csvBoolFmt != "" && !ok {
+		fmt.Fprintln(os.Stderr, "Bool format must be 01, truefalse or yn!")
+		os.Exit(1)
+	}
 
-// readRows executes a query and sends each row over a channel to be consumed
-func readRows(db *sql.DB, query string, dataChan chan []sql.RawBytes, quitChan chan bool, goChan chan bool, csvHeader bool) {
-	rows, err := db.Query(query)
-	defer rows.Close()
-	if err != nil {
-		log.Print(err)
+	switch *csvBinary {
+	case "raw", "hex", "base64":
+	default:
+		fmt.Fprintln(os.Stderr, "Binary encoding must be raw, hex or base64!")
 		os.Exit(1)
 	}
 
-	cols, err := rows.Columns()
-	checkErr(err)
+	// Text columns are reported as binary when results use the binary character set
+	if *csvBinary != "raw" && *dbCharset == "binary" {
+		fmt.Fprintln(os.Stderr, "Warning: -charset=binary reports text columns as binary, set -charset to encode only binary columns")
+	}
 
-	// Write columns as a header line
-	if csvHeader {
-		headers := make([]sql.RawBytes, len(cols))
-		for i, col := range cols {
-			headers[i] = []byte(col)
+	// Validate output format options
+	switch *csvFormat {
+	case "csv":
+	case "sql":
+		if *sqlTable == "" {
+			fmt.Fprintln(os.Stderr, "You must provide a table name for sql format!")
+			os.Exit(1)
 		}
-		dataChan <- headers
-		<-goChan
+		if *sqlBatch < 1 {
+			fmt.Fprintln(os.Stderr, "Batch insert size must be at least 1!")
+			os.Exit(1)
+		}
+	case "table":
+		if *tableSample < 1 {
+			fmt.Fprintln(os.Stderr, "Table sample size must be at least 1!")
+			os.Exit(1)
+		}
+	case "lenprefix", "html":
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown output format", *csvFormat)
+		os.Exit(1)
 	}
 
-	// Need to scan into empty interface since we don't know how many columns a query might return
-	scanVals := make([]interface{}, len(cols))
-	vals := make([]sql.RawBytes, len(cols))
-	for i := range vals {
-		scanVals[i] = &vals[i]
+	// Raw output is a distinct format so options that rely on CSV framing reject it
+	if *csvRaw {
+		if *csvFormat != "csv" {
+			fmt.Fprintln(os.Stderr, "-raw can not be used with -format!")
+			os.Exit(1)
+		}
+		if *csvAddHost || *csvAddDB || *csvAddQuery || *csvHash != "" || *csvVerify {
+			fmt.Fprintln(os.Stderr, "-raw can not be used with metadata columns, -row-hash or -verify!")
+			os.Exit(1)
+		}
+		*csvFormat = "raw"
+		*csvHeader = false
 	}
 
-	for rows.Next() {
-		err := rows.Scan(scanVals...)
-		checkErr(err)
-
-		dataChan <- vals
-
-		// Block and wait for writeRows() to signal back it has consumed the data
-		// This is necessary because sql.RawBytes is a memory pointer and when rows.Next()
-		// loops and change the memory address before writeRows can properly process the values
-		<-goChan
+	// Numbered output files are split by row count or size
+	split := *csvSplit > 0 || *csvSplitBytes > 0
+	if *csvSplitBytes < 0 {
+		fmt.Fprintln(os.Stderr, "-split-bytes must be a positive number of bytes!")
+		os.Exit(1)
 	}
 
-	err = rows.Err()
-	checkErr(err)
+	// Exploded rows are written to a file each in the -file directory
+	var explodeName, explodeContent string
+	if *csvExplode != "" {
+		parts := strings.SplitN(*csvExplode, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			fmt.Fprintln(os.Stderr, "-explode must be name-column=content-column!")
+			os.Exit(1)
+		}
+		explodeName, explodeContent = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 
-	close(dataChan)
-	quitChan <- true
-}
+		if *csvFile == "" || objectURL(*csvFile) || *csvFormat != "csv" || *queryDir != "" || *bundleFile != "" || *watchEvery != 0 {
+			fmt.Fprintln(os.Stderr, "-explode requires a local -file directory and can not be used with -format, -raw, -query-dir, -bundle or -watch!")
+			os.Exit(1)
+		}
+		if *csvAddHost || *csvAddDB || *csvAddQuery || *csvHash != "" || *csvVerify || *csvCompress != "none" || *csvRotate != 0 || split || *manifestFile != "" || *headerFile != "" || *sqlldrTable != "" || *csvUnpivot != "" || *skipEmpty {
+			fmt.Fprintln(os.Stderr, "-explode can not be used with metadata columns, -row-hash, -verify, -compress, -rotate-interval, -split, -split-bytes, -manifest, -header-file, -sqlldr, -unpivot or -skip-empty-file!")
+			os.Exit(1)
+		}
+		*csvFormat = "explode"
+		*csvHeader = false
+	}
 
-// writeCSV reads from a channel and writes CSV output
-func writeCSV(w *Writer, dataChan chan []sql.RawBytes, goChan chan bool, verbose bool) uint {
-	var rowsWritten uint
-	var verboseCount uint
+	// A bundle stages the data, schema and report in a temporary directory using the
+	// normal writers, they are archived together once the export completes. The names are
+	// moved into the directory once it is created after the connection and preflight checks.
+	if *bundleFile != "" {
+		if *csvFile != "" || *queryDir != "" || *schemaFile != "" || *reportFile != "" {
+			fmt.Fprintln(os.Stderr, "-bundle can not be used with -file, -query-dir, -schema-file or -report!")
+			os.Exit(1)
+		}
+		if *csvCompress != "none" || *csvRotate != 0 || split || *watchEvery != 0 {
+			fmt.Fprintln(os.Stderr, "-bundle can not be used with -compress, -rotate-interval, -split, -split-bytes or -watch!")
+			os.Exit(1)
+		}
 
-	if verbose {
-		fmt.Println("A '.' will be shown for every 10,000 CSV rows written")
+		*csvFile = "data" + outputExtension(*csvFormat)
+		*schemaFile = "schema.json"
+		*reportFile = "report.json"
 	}
 
-	// Range over row results from readRows()
-	for data := range dataChan {
-		// Format the data to CSV and write
-		size, err := w.Write(data)
-		checkErr(err)
+	// An empty output is removed so it has to be a single local file
+	if *skipEmpty && (*csvFile == "" || objectURL(*csvFile) || *queryDir != "" || *csvRotate != 0 || split || *watchEvery != 0 || *bundleFile != "") {
+		fmt.Fprintln(os.Stderr, "-skip-empty-file requires a local output file and can not be used with -query-dir, -rotate-interval, -split, -split-bytes, -watch or -bundle!")
+		os.Exit(1)
+	}
 
-		// Visual write indicator when verbose is enabled
-		rowsWritten++
-		if verbose {
-			verboseCount++
-			if verboseCount == 10000 {
-				fmt.Printf(".")
-				verboseCount = 0
-			}
-		}
+	// Output is read back a byte at a time
+	if (*csvVerify || *csvDiff != "") && (len(*csvQuote) > 1 || len(*csvEscape) > 1) {
+		fmt.Fprintln(os.Stderr, "-verify and -diff-against require a single character quote and escape!")
+		os.Exit(1)
+	}
 
-		// Flush CSV writer contents once it exceeds flushBufferSize
-		if size > flushBufferSize {
-			w.Flush()
-			err = w.Error()
-			checkErr(err)
+	// Only local files can be read back
+	if *csvVerify && (*csvFile == "" || objectURL(*csvFile)) {
+		fmt.Fprintln(os.Stderr, "-verify requires a local output file!")
+		os.Exit(1)
+	}
+	// Validate compression options, a .gz file is compressed unless told otherwise
+	compressSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "compress" {
+			compressSet = true
 		}
-
-		// Signal back to readRows() it can loop and scan the next row
-		goChan <- true
+	})
+	if !compressSet && *queryDir == "" && *csvExplode == "" && strings.HasSuffix(*csvFile, ".gz") {
+		*csvCompress = "gzip"
+	}
+	switch *csvCompress {
+	case "none", "gzip":
+	case "bgzip":
+		if *csvFile == "" && *queryDir == "" {
+			fmt.Fprintln(os.Stderr, "-compress=bgzip requires an output file for the .gzi index!")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown compression", *csvCompress)
+		os.Exit(1)
+	}
+	if *csvRotate != 0 {
+		if *csvFile == "" || *queryDir != "" {
+			fmt.Fprintln(os.Stderr, "-rotate-interval requires an output file!")
+			os.Exit(1)
+		}
+		if *csvRotate < time.Second {
+			fmt.Fprintln(os.Stderr, "Rotate interval must be at least 1s!")
+			os.Exit(1)
+		}
+		if *csvVerify {
+			fmt.Fprintln(os.Stderr, "-verify is not supported with -rotate-interval!")
+			os.Exit(1)
+		}
+	}
+	if split {
+		if *csvSplit > 0 && *csvSplitBytes > 0 {
+			fmt.Fprintln(os.Stderr, "-split and -split-bytes can not be used together, choose a row count or a size!")
+			os.Exit(1)
+		}
+		if *csvFile == "" || *queryDir != "" {
+			fmt.Fprintln(os.Stderr, "-split and -split-bytes require an output file!")
+			os.Exit(1)
+		}
+		if *csvRotate != 0 {
+			fmt.Fprintln(os.Stderr, "-split and -split-bytes can not be used with -rotate-interval!")
+			os.Exit(1)
+		}
+		if *csvVerify {
+			fmt.Fprintln(os.Stderr, "-verify is not supported with -split or -split-bytes!")
+			os.Exit(1)
+		}
+	}
+	if *htmlClass != "" && *csvFormat != "html" {
+		fmt.Fprintln(os.Stderr, "-html-class requires html format!")
+		os.Exit(1)
+	}
+	if *csvVerify && (*csvFormat == "table" || *csvFormat == "lenprefix" || *csvFormat == "html") {
+		fmt.Fprintln(os.Stderr, "-verify is not supported for", *csvFormat, "format!")
+		os.Exit(1)
+	}
+
+	switch *countHeader {
+	case "":
+	case "line", "file":
+		if *queryDir != "" || *watchEvery != 0 || *csvRotate != 0 || split || *csvUnpivot != "" || *csvDiff != "" || *countOnly {
+			fmt.Fprintln(os.Stderr, "-count-header can not be used with -query-dir, -watch, -rotate-interval, -split, -split-bytes, -unpivot, -diff-against or -count-only!")
+			os.Exit(1)
+		}
+		if *countHeader == "line" && (*csvFormat != "csv" || *sqlldrTable != "") {
+			fmt.Fprintln(os.Stderr, "-count-header=line requires csv format and can not be used with -sqlldr!")
+			os.Exit(1)
+		}
+		if *countHeader == "file" && (*csvFile == "" || *csvExplode != "" || *bundleFile != "") {
+			fmt.Fprintln(os.Stderr, "-count-header=file requires an output file and can not be used with -explode or -bundle!")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Count header must be line or file!")
+		os.Exit(1)
+	}
+
+	if *countOnly && (*csvFile != "" || *queryDir != "") {
+		fmt.Fprintln(os.Stderr, "-count-only does not write output, -file and -query-dir can not be used!")
+		os.Exit(1)
+	}
+	if *countOnly && !derivedQuery(query) {
+		fmt.Fprintln(os.Stderr, "-count-only requires a select or with query!")
+		os.Exit(1)
+	}
+
+	if *headerFile != "" && (*queryDir != "" || *csvFormat != "csv") {
+		fmt.Fprintln(os.Stderr, "-header-file requires csv format and can not be used with -query-dir!")
+		os.Exit(1)
+	}
+	if *manifestFile != "" && *csvFile == "" && *queryDir == "" {
+		fmt.Fprintln(os.Stderr, "-manifest requires output files!")
+		os.Exit(1)
+	}
+	if *schemaFile != "" && *queryDir != "" {
+		fmt.Fprintln(os.Stderr, "-schema-file can not be used with -query-dir!")
+		os.Exit(1)
+	}
+	var unpivotKeys, unpivotMeasures []string
+	if *csvUnpivot != "" {
+		var err error
+		unpivotKeys, unpivotMeasures, err = parseUnpivot(*csvUnpivot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *csvRaw || *sortCol != "" || *schemaFile != "" || *bundleFile != "" {
+			fmt.Fprintln(os.Stderr, "-unpivot can not be used with -raw, -sort-output, -schema-file or -bundle!")
+			os.Exit(1)
+		}
+	}
+	var coalesceName string
+	var coalesceSources []string
+	if *csvCoalesce != "" {
+		var err error
+		coalesceName, coalesceSources, err = parseCoalesce(*csvCoalesce)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *csvRaw || *csvFormat == "explode" || *csvUnpivot != "" || *sortCol != "" || *schemaFile != "" || *bundleFile != "" {
+			fmt.Fprintln(os.Stderr, "-coalesce can not be used with -raw, -explode, -unpivot, -sort-output, -schema-file or -bundle!")
+			os.Exit(1)
+		}
+	} else if *coalesceDrop {
+		fmt.Fprintln(os.Stderr, "-coalesce-drop requires -coalesce!")
+		os.Exit(1)
+	}
+	if *csvReverse {
+		if *reverseMax < 1 {
+			fmt.Fprintln(os.Stderr, "Reverse max rows must be at least 1!")
+			os.Exit(1)
+		}
+		if *sortCol != "" || *csvRotate != 0 || split {
+			fmt.Fprintln(os.Stderr, "-reverse can not be used with -sort-output, -rotate-interval, -split or -split-bytes, use -sort-desc to reverse sorted output!")
+			os.Exit(1)
+		}
+		logger.Printf("Warning: -reverse holds up to %d rows in memory and writes nothing until the query completes\n", *reverseMax)
+	}
+	if *sortCol != "" {
+		if *sortMax < 1 {
+			fmt.Fprintln(os.Stderr, "Sort max rows must be at least 1!")
+			os.Exit(1)
+		}
+		if *csvRotate != 0 || split {
+			fmt.Fprintln(os.Stderr, "-sort-output can not be used with -rotate-interval, -split or -split-bytes!")
+			os.Exit(1)
+		}
+		logger.Printf("Warning: -sort-output holds up to %d rows in memory and writes nothing until the query completes\n", *sortMax)
+	}
+	if *sqlldrTable != "" {
+		if *csvFile == "" || *queryDir != "" || *csvFormat != "csv" {
+			fmt.Fprintln(os.Stderr, "-sqlldr requires an output file, csv format and a single query!")
+			os.Exit(1)
+		}
+		if *csvCompress != "none" || *csvRotate != 0 || split {
+			fmt.Fprintln(os.Stderr, "-sqlldr can not be used with -compress, -rotate-interval, -split or -split-bytes!")
+			os.Exit(1)
+		}
+		if *dbParseTime {
+			fmt.Fprintln(os.Stderr, "-sqlldr date formats do not match -parse-time output!")
+			os.Exit(1)
+		}
+	}
+
+	// Output is buffered in large blocks so network filesystems see few, large writes
+	if *csvBuffer < 1 {
+		fmt.Fprintln(os.Stderr, "Buffer size must be at least 1 megabyte!")
+		os.Exit(1)
+	}
+	flushSize := *csvBuffer * 1024 * 1024
+
+	if *rowBuffer < 0 {
+		fmt.Fprintln(os.Stderr, "Row buffer must not be negative!")
+		os.Exit(1)
+	}
+
+	if *pageSize < 0 {
+		fmt.Fprintln(os.Stderr, "Page size must not be negative!")
+		os.Exit(1)
+	}
+	if *pageSize > 0 {
+		if *orderKey == "" {
+			fmt.Fprintln(os.Stderr, "-page-size requires -order-key!")
+			os.Exit(1)
+		}
+		if *showWarn {
+			fmt.Fprintln(os.Stderr, "-show-warnings can not be used with -page-size!")
+			os.Exit(1)
+		}
+		if *queryDir == "" && !derivedQuery(query) {
+			fmt.Fprintln(os.Stderr, "-page-size requires a select or with query!")
+			os.Exit(1)
+		}
+	}
+
+	if *lockRetries < 0 {
+		fmt.Fprintln(os.Stderr, "Lock retries must not be negative!")
+		os.Exit(1)
+	}
+
+	if *watchEvery < 0 {
+		fmt.Fprintln(os.Stderr, "Watch interval must not be negative!")
+		os.Exit(1)
+	}
+	if *watchEvery > 0 {
+		if *queryDir != "" || *countOnly {
+			fmt.Fprintln(os.Stderr, "-watch can not be used with -query-dir or -count-only!")
+			os.Exit(1)
+		}
+		watchStop = make(chan struct{})
+	}
+
+	// Check if Stdin has been redirected and reset so the user can be prompted for a password
+	checkStdin()
+
+	// Catch signals
+	catchNotifications()
+
+	// Broken pipes are reported as write errors instead of killing the process
+	signal.Ignore(syscall.SIGPIPE)
+
+	// CPU Profiling
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		checkErr(err)
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+
+	if *dbTimeout < 0 || *dbReadTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "Timeout can not be negative!")
+		os.Exit(1)
+	}
+
+	// Default to localhost if no host or socket provided
+	if *dbSocket != "" {
+		if *socksAddr != "" {
+			fmt.Fprintln(os.Stderr, "-socket can not be used with -socks5!")
+			os.Exit(1)
+		}
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "host" || f.Name == "port" {
+				logger.Printf("Warning: -%s is ignored when connecting over -socket\n", f.Name)
+			}
+		})
+	} else if *dbHost == "" {
+		*dbHost = "127.0.0.1"
+	}
+
+	// Need to provide a target
+	if *dbUser == "" {
+		fmt.Fprintln(os.Stderr, "You must provide a user name!")
+		os.Exit(1)
+	}
+
+	// Read the password from an inherited file descriptor instead of prompting
+	if *dbPassFD >= 0 {
+		if *dbPass != "" {
+			fmt.Fprintln(os.Stderr, "-pass and -pass-fd can not be used together!")
+			os.Exit(1)
+		}
+
+		pwd, err := readPasswordFD(*dbPassFD)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read password from file descriptor", *dbPassFD, err)
+			os.Exit(1)
+		}
+		*dbPass = pwd
+	}
+
+	// If password is blank prompt user
+	if *dbPass == "" && *dbPassFD < 0 {
+		// The prompt goes to stderr so it never mixes with output on stdout
+		fmt.Fprint(os.Stderr, *passPrompt)
+		pwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			if err != io.EOF {
+				checkErr(err)
+			}
+		}
+		*dbPass = string(pwd)
+	}
+
+	// Populate dbInfo struct with flag values
+	dbi := dbInfo{user: *dbUser, pass: *dbPass, host: *dbHost, port: *dbPort, socket: *dbSocket, timeout: time.Duration(*dbTimeout) * time.Second, readTimeout: time.Duration(*dbReadTimeout) * time.Second, charset: *dbCharset, tls: *dbTLS || *tlsSkip, tlsConfig: "skip-verify", tlsCA: *tlsCA, tlsCert: *tlsCert, tlsKey: *tlsKey, tlsSkip: *tlsSkip, parseTime: *dbParseTime, loc: *dbLoc, timeZone: *dbTimeZone, network: "tcp", initCmd: *dbInitCmd, driver: *dbDriver}
+
+	// A pinned certificate replaces CA verification and implies -tls
+	if pin != nil {
+		err := registerTLSPin(pin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		dbi.tls = true
+		dbi.tlsConfig = pinnedTLS
+	}
+
+	// CA & client certificates are verified unless skipping verification is asked for
+	if dbi.tlsCA != "" || dbi.tlsCert != "" {
+		if dbi.driver == "mysql" {
+			err := registerTLSFiles(dbi.tlsCA, dbi.tlsCert, dbi.tlsKey, dbi.tlsSkip)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			dbi.tlsConfig = customTLS
+		}
+		dbi.tls = true
+	} else if *dbTLS && pin == nil && !dbi.tlsSkip {
+		logger.Println("Warning: -tls does not verify the server certificate, use -ca to verify it or -tls-skip-verify to accept any certificate")
+	}
+
+	// Connections are dialed through the proxy using the network name registered for it
+	if *socksAddr != "" {
+		err := registerSOCKS5(*socksAddr, *socksUser, *socksPass)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		dbi.network = socksNetwork
+	}
+
+	if *verbose {
+		if dbi.socket != "" {
+			logger.Println("Connecting over unix socket", dbi.socket)
+		} else {
+			logger.Println("Connecting over TCP to", dbi.address())
+		}
+		if dbi.timeout > 0 {
+			logger.Println("Connection timeout is", dbi.timeout)
+		} else {
+			logger.Println("Connection timeout is disabled")
+		}
+		if dbi.readTimeout > 0 {
+			logger.Println("Read & write timeout is", dbi.readTimeout)
+		}
+	}
+
+	// Create a *sql.DB connection to the source database. The driver reports a read timeout
+	// during the handshake as a bad connection once database/sql has retried it, one cut off
+	// by the timeout is reported as the context deadline.
+	connectStart := time.Now()
+	db, err := dbi.connect()
+	defer db.Close()
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) && dbi.timeout > 0 && time.Since(connectStart) >= dbi.timeout {
+		fatal(exitConnectError, fmt.Errorf("Unable to connect to %s within %s, check the server is reachable or raise -timeout", dbi.address(), dbi.timeout))
+	}
+	if err != nil {
+		fatal(exitConnectError, err)
+	}
+
+	// Only size the result set
+	if *countOnly {
+		count, approximate, err := countRows(db, query, *countExact)
+		if err != nil {
+			fatal(exitQueryError, err)
+		}
+		if approximate && *verbose {
+			logger.Println("Row count is an estimate from information_schema, use -exact to count every row")
+		}
+		fmt.Println(count)
+		os.Exit(0)
+	}
+
+	// Abort before any output is created if the precondition does not hold. The count is
+	// taken first too, rows changed before the export reads them make the two differ.
+	upfrontCount, err := preflight(db, query, *precheck, *countHeader != "")
+	if err != nil {
+		fatal(exitQueryError, err)
+	}
+
+	var bundle *bundleStage
+	if *bundleFile != "" {
+		bundle, err = stageBundle(*bundleFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*csvFile = filepath.Join(bundle.dir, *csvFile)
+		*schemaFile = filepath.Join(bundle.dir, *schemaFile)
+		*reportFile = filepath.Join(bundle.dir, *reportFile)
+	}
+
+	// The run report is created first so it can record every output file
+	if *reportFile != "" || *auditSyslog {
+		var reportOut io.WriteCloser
+		if *reportFile != "" {
+			reportOut, err = createOutput(*reportFile)
+			if err != nil {
+				exitWith("failed", 1, err)
+			}
+		}
+		report = newRunReport(reportOut, start)
+		if *queryDir == "" {
+			report.setQuery(query)
+		}
+	}
+	if *auditSyslog {
+		audit, err := openSyslog(*syslogAddr)
+		if err != nil {
+			exitWith("failed", 1, fmt.Errorf("Unable to connect to syslog: %s", err))
+		}
+		if audit != nil {
+			report.setAudit(audit, dbi.user, dbi.address())
+		}
+	}
+
+	// Create CSV output file or object if supplied, otherwise use standard out
+	var writeTo string
+	var writerDest io.Writer
+	var output io.WriteCloser
+	var rotate *rotatingOutput
+	var outFile *outputFile
+	if *queryDir != "" {
+		writeTo = "files in " + *csvFile
+		if *csvFile == "" {
+			writeTo = "files in the current directory"
+		}
+	} else if *csvFormat == "explode" {
+		err = os.MkdirAll(*csvFile, 0755)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		writeTo = "a file per row in " + *csvFile
+	} else if *csvFile == "" {
+		writeTo = "standard out"
+		writerDest = os.Stdout
+		if report != nil {
+			report.stdout = &countingOutput{WriteCloser: os.Stdout}
+			writerDest = report.stdout
+		}
+		if *csvCompress == "gzip" {
+			output, err = compressOutput(nopWriteCloser{writerDest}, "", "gzip")
+			checkErr(err)
+			writerDest = output
+		}
+	} else if *csvRotate > 0 {
+		rotate, err = newRotatingOutput(*csvFile, *csvCompress, *csvRotate)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		output = rotate
+		writerDest = output
+		writeTo = "timestamped files named after " + *csvFile
+	} else if split {
+		rotate, err = newSplitOutput(*csvFile, *csvCompress, *csvSplit, *csvSplitBytes)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		output = rotate
+		writerDest = output
+		writeTo = "numbered files starting with " + rotate.files[0].name
+	} else {
+		output, outFile, err = openOutput(*csvFile, *csvCompress)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		writerDest = output
+		writeTo = *csvFile
+	}
+	report.auditStart(writeTo)
+
+	// The header is written to its own file so the data holds only rows
+	var headerOut io.WriteCloser
+	if *headerFile != "" {
+		headerOut, err = createOutput(*headerFile)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		*csvHeader = false
+	}
+
+	// The manifest lists every output file once they are all finalized
+	var manifestOut io.WriteCloser
+	if *manifestFile != "" {
+		manifestOut, err = createOutput(*manifestFile)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+	}
+
+	// The schema sidecar describes a single query's columns
+	var schemaOut io.WriteCloser
+	if *schemaFile != "" {
+		schemaOut, err = createOutput(*schemaFile)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+	}
+
+	// The SQL*Loader control file is written once the output columns are known
+	var sqlldrOut io.WriteCloser
+	if *sqlldrTable != "" {
+		sqlldrOut, err = createOutput(controlFileName(*csvFile))
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+	}
+
+	if *verbose {
+		logger.Start(writeTo)
+	}
+
+	// Have the server abort the query if it runs too long
+	if *maxExecTime > 0 {
+		if *queryDir == "" {
+			query, err = addExecutionTimeHint(query, *maxExecTime)
+			if err != nil {
+				exitWith("failed", 1, err)
+			}
+		}
+
+		version, err := serverVersion(db)
+		checkErr(err)
+		if !versionAtLeast(version, 5, 7, 8) {
+			logger.Printf("Warning: server version %s may not support MAX_EXECUTION_TIME, MySQL 5.7.8 or newer is required\n", version)
+		}
+	}
+
+	// Populate exportInfo struct with flag values
+	exi := exportInfo{query: query, header: *csvHeader, verbose: *verbose, format: *csvFormat, table: *sqlTable, batch: *sqlBatch, sample: *tableSample, htmlClass: *htmlClass, explodeDir: *csvFile, explodeName: explodeName, explodeContent: explodeContent, flushSize: flushSize, trim: *csvTrim, trimCols: splitList(*csvTrimCols), colsCase: *csvColsCase, geometry: *csvGeometry, binary: *csvBinary, keepalive: *dbKeepalive, print0: *csvPrint0, verify: *csvVerify, addHost: *csvAddHost, addDB: *csvAddDB, addQuery: *csvAddQuery, throttle: *csvThrottle, warnings: *showWarn, compress: *csvCompress, rowBuffer: *rowBuffer, schema: schemaOut, cost: *showCost, rotate: rotate, headerOut: headerOut, dedup: *csvDedup, hash: *csvHash, hashColumn: *csvHashColumn, previous: previous, sqlldr: sqlldrOut, ctlTable: *sqlldrTable, ctlInfile: *csvFile, sortCol: *sortCol, sortDesc: *sortDesc, sortMax: *sortMax, reverse: *csvReverse, reverseMax: *reverseMax, countLine: *countHeader == "line", floatFmt: *csvFloatFmt, boolFmt: *csvBoolFmt, numberFmt: *csvNumberFmt, nullFold: *csvNullFold, pads: pads, unpivotKeys: unpivotKeys, unpivotMeasures: unpivotMeasures, coalesceName: coalesceName, coalesceSources: coalesceSources, coalesceDrop: *coalesceDrop, pageSize: *pageSize, orderKey: *orderKey, lockRetries: *lockRetries, trimFinal: *trimFinal && *csvFile == "" && *queryDir == "" && *watchEvery == 0, profile: *csvProfile, typecheck: *typecheck, maxCols: *maxCols}
+
+	// Escapes are decoded so \r\n is seen as 2 bytes (ascii 13 & 10) instead of 4
+	// Newline is default but decode here in case it is manually passed in
+	exi.delimiter = decodeEscapes(*csvDelimiter)
+	exi.quote = *csvQuote
+	exi.doubleQuote = doubleQuote
+	exi.rfc4180 = *csvRFC4180
+	exi.escape = *csvEscape
+	exi.terminator = decodeEscapes(*csvTerminator)
+	exi.prefix = decodeEscapes(*csvPrefix)
+	exi.suffix = decodeEscapes(*csvSuffix)
+	exi.newline = newline
+	exi.replace = decodeEscapes(*csvReplace)
+	exi.nullString = exi.escape + "N"
+	if *csvRFC4180 {
+		exi.nullString = ""
+	}
+	if nullSet {
+		exi.nullString = *csvNull
+	}
+	for _, v := range csvNullIf {
+		exi.nullIf = append(exi.nullIf, []byte(v))
+	}
+
+	// Literal \N values stay distinct from NULL because their escape character is escaped,
+	// without an escape or quote character there is nothing to tell them apart
+	if exi.escape == "" && exi.quote == "" && exi.format == "csv" && !nullSet {
+		logger.Println("Warning: with no escape or quote character NULL is written as N and can not be told apart from the value N")
+	}
+
+	// Provenance values for metadata columns
+	exi.host = dbi.address()
+	if exi.addDB {
+		// Postgres names the current database with current_database()
+		current := "SELECT DATABASE()"
+		if dbi.driver == "postgres" {
+			current = "SELECT current_database()"
+		}
+
+		var database sql.NullString
+		err = db.QueryRow(current).Scan(&database)
+		checkErr(err)
+		if database.Valid {
+			exi.database = []byte(database.String)
+		}
+	}
+
+	// NUL terminated unquoted records for xargs -0 style consumers
+	if exi.print0 {
+		exi.terminator = "\x00"
+		exi.quote = ""
+	}
+
+	// The query is cancelled once the maximum runtime from start is reached, the rows read
+	// before then are written and the output is closed as normal
+	exi.ctx = context.Background()
+	if *maxRuntime > 0 {
+		var cancel context.CancelFunc
+		exi.ctx, cancel = context.WithDeadline(exi.ctx, start.Add(*maxRuntime))
+		defer cancel()
+	}
+
+	// The row count goes before the data for loaders that need it upfront
+	switch *countHeader {
+	case "line":
+		_, err = fmt.Fprintf(writerDest, "%d%s", upfrontCount, exi.terminator)
+		if err != nil {
+			writeFailed(err)
+		}
+	case "file":
+		countOut, err := createOutput(*csvFile + ".count")
+		if err == nil {
+			_, err = fmt.Fprintf(countOut, "%d\n", upfrontCount)
+			if cerr := countOut.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// Run each query in the query directory as a separate export
+	var rowCount uint
+	if *queryDir != "" {
+		rowCount = exi.exportDir(db, *queryDir, *csvFile, *maxExecTime)
+	} else if *watchEvery > 0 {
+		rowCount = exi.watch(db, writerDest, time.Duration(*watchEvery)*time.Second)
+	} else {
+		rowCount = exi.export(db, writerDest)
+	}
+
+	if *countHeader != "" && int64(rowCount) != upfrontCount {
+		logger.Printf("Warning: %d rows were written but the count written before them is %d, the data changed while exporting\n", rowCount, upfrontCount)
+	}
+
+	// Closing the output finalizes it, cloud storage objects only exist once this succeeds
+	empty := false
+	if output != nil {
+		err = output.Close()
+		if err != nil {
+			writeFailed(err)
+		}
+
+		// Pipelines that treat a file as data are left no file for an empty result
+		if *skipEmpty && rowCount == 0 && !runtimeExceeded {
+			err = removeOutput(*csvFile, *csvCompress)
+			if err != nil {
+				writeFailed(err)
+			}
+			report.removeFile(outFile)
+			outFile = nil
+			empty = true
+		}
+
+		if exi.verify && !empty {
+			err = exi.verifyOutput(*csvFile, rowCount)
+			if err != nil {
+				exitWith("failed", 1, err)
+			}
+		}
+	}
+
+	// Rotated files count their own rows, a single output file holds every row
+	if rotate != nil {
+		exi.outputs = rotate.files
+	} else if outFile != nil {
+		outFile.rows = rowCount
+		exi.outputs = append(exi.outputs, outFile)
+	}
+
+	if manifestOut != nil {
+		err = writeManifest(manifestOut, exi.outputs)
+		if err == nil {
+			err = manifestOut.Close()
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// Members are named relative to the archive instead of the staging directory
+	if bundle != nil {
+		outFile.name = filepath.Base(outFile.name)
+	}
+
+	if runtimeExceeded {
+		fmt.Fprintf(os.Stderr, "Maximum runtime of %s exceeded, the export was stopped after %d rows\n", *maxRuntime, rowCount)
+	}
+	status, code := exportStatus(runtimeExceeded, empty)
+	report.finish(status, code, nil)
+
+	if bundle != nil {
+		err = writeBundle(bundle.out, *bundleFile, start, bundleFiles(bundle.dir, query))
+		if err == nil {
+			err = bundle.out.Close()
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// Memory Profiling
+	if *memprofile != "" {
+		f, err := os.Create(*memprofile)
+		checkErr(err)
+		pprof.WriteHeapProfile(f)
+		defer f.Close()
+	}
+
+	if *verbose {
+		logger.Complete(rowCount, time.Since(start))
+	}
+
+	if empty && *verbose {
+		logger.Println("The query returned no rows,", *csvFile, "was removed")
+	}
+
+	runCleanups()
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// exportStatus returns the run report status and exit code of an export that finished, one
+// stopped by -max-runtime keeps the rows written and exits 124 like timeout(1)
+func exportStatus(timedOut bool, empty bool) (string, int) {
+	switch {
+	case timedOut:
+		return "timed out", exitTimedOut
+	case empty:
+		return "empty", exitEmptyResult
+	}
+
+	return "complete", 0
+}
+
+// Create a writer for the output format that writes to dest
+func (exi *exportInfo) newWriter(dest io.Writer) recordWriter {
+	if exi.format == "sql" {
+		SQLWriter := NewSQLWriterSize(dest, exi.flushSize)
+		SQLWriter.Table = exi.table
+		SQLWriter.Batch = exi.batch
+
+		return SQLWriter
+	}
+
+	if exi.format == "table" {
+		TableWriter := NewTableWriterSize(dest, exi.flushSize)
+		TableWriter.Sample = exi.sample
+
+		return TableWriter
+	}
+
+	if exi.format == "lenprefix" {
+		return NewLenPrefixWriterSize(dest, exi.flushSize)
+	}
+
+	if exi.format == "explode" {
+		return NewExplodeWriter(exi.explodeDir)
+	}
+
+	if exi.format == "html" {
+		HTMLWriter := NewHTMLWriterSize(dest, exi.flushSize)
+		HTMLWriter.Class = exi.htmlClass
+
+		return HTMLWriter
+	}
+
+	if exi.format == "raw" {
+		RawWriter := NewRawWriterSize(dest, exi.flushSize)
+		RawWriter.Terminator = exi.terminator
+
+		return RawWriter
+	}
+
+	CSVWriter := NewWriterSize(dest, exi.flushSize)
+	CSVWriter.Delimiter = exi.delimiter
+	CSVWriter.Quote = exi.quote
+	CSVWriter.Escape = exi.escape
+	CSVWriter.Terminator = exi.terminator
+	CSVWriter.Prefix = exi.prefix
+	CSVWriter.Suffix = exi.suffix
+	CSVWriter.Newline = exi.newline
+	CSVWriter.Replace = exi.replace
+	CSVWriter.NullString = exi.nullString
+	CSVWriter.TrimFinal = exi.trimFinal
+	CSVWriter.DoubleQuote = exi.doubleQuote
+	CSVWriter.RFC4180 = exi.rfc4180
+
+	return CSVWriter
+}
+
+// readEscape returns the escape character to expect when reading output back, doubled quote
+// output has none
+func (exi *exportInfo) readEscape() string {
+	if exi.doubleQuote {
+		return ""
+	}
+
+	return exi.escape
+}
+
+// export runs the query and writes the results to dest, returning the number of rows written
+func (exi *exportInfo) export(db *sql.DB, dest io.Writer) uint {
+	// A cost estimate is only informational so failures are reported and the export continues
+	if exi.cost {
+		cost, rows, err := queryCost(db, exi.query)
+		if err != nil {
+			logger.Println("Warning: query cost is not available:", err)
+		} else {
+			logger.Printf("Estimated query cost = %s, rows = %.0f\n", cost, rows)
+		}
+	}
+
+	// Create channels
+	colChan := make(chan []column)
+	dataChan := make(chan []sql.RawBytes, exi.rowBuffer)
+	quitChan := make(chan bool)
+	goChan := make(chan bool)
+
+	// Count the bytes written for the status line
+	exi.progress = nil
+	if exi.verbose && logger.status {
+		exi.progress = &progressWriter{Writer: dest}
+		dest = exi.progress
+	}
+
+	// Start reading & writing
+	go readRows(db, *exi, colChan, dataChan, quitChan, goChan)
+	rowCount := writeCSV(exi.newWriter(dest), *exi, colChan, dataChan, goChan)
+
+	// Block on quitChan until readRows() completes
+	<-quitChan
+	close(quitChan)
+	close(goChan)
+
+	return rowCount
+}
+
+// watch runs the export every interval until stopped by a signal, appending to dest.
+// The header and side files are only written by the first run, files rotated to later still
+// get a header and sql keeps its column list.
+func (exi *exportInfo) watch(db *sql.DB, dest io.Writer, interval time.Duration) uint {
+	var total uint
+	for {
+		rows := exi.export(db, dest)
+		total += rows
+		if runtimeExceeded {
+			return total
+		}
+		if exi.verbose {
+			logger.Println()
+			logger.Println(rows, "rows written, next run in", interval)
+		}
+
+		// The sql header is the INSERT column list and writes nothing, every run needs it
+		if exi.format != "sql" {
+			exi.appending = true
+		}
+		exi.headerOut = nil
+		exi.schema = nil
+		exi.sqlldr = nil
+
+		select {
+		case <-watchStop:
+			return total
+		case <-exi.ctx.Done():
+			return total
+		case <-time.After(interval):
+		}
+	}
+}
+
+// outputExtension returns the file extension used for output in format
+func outputExtension(format string) string {
+	switch format {
+	case "sql":
+		return ".sql"
+	case "lenprefix":
+		return ".bin"
+	case "html":
+		return ".html"
+	case "raw":
+		return ".raw"
+	default:
+		return ".csv"
+	}
+}
+
+// exportDir exports every .sql file in dir to an output file of the same name in outDir.
+// Files that are not valid queries are reported and skipped.
+func (exi *exportInfo) exportDir(db *sql.DB, dir string, outDir string, maxExecTime int) uint {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	checkErr(err)
+
+	if outDir == "" {
+		outDir = "."
+	}
+
+	ext := outputExtension(exi.format)
+	if exi.compress != "none" {
+		ext += ".gz"
+	}
+
+	var total uint
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		checkErr(err)
+
+		query := string(b)
+		if err := validateQuery(query); err != nil {
+			fmt.Fprintln(os.Stderr, file, "skipped:", err)
+			continue
+		}
+		if exi.pageSize > 0 && !derivedQuery(query) {
+			fmt.Fprintln(os.Stderr, file, "skipped: -page-size requires a select or with query")
+			continue
+		}
+		if maxExecTime > 0 {
+			query, err = addExecutionTimeHint(query, maxExecTime)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, file, "skipped:", err)
+				continue
+			}
+		}
+
+		name := strings.TrimSuffix(outDir, "/") + "/" + strings.TrimSuffix(filepath.Base(file), ".sql") + ext
+		output, outFile, err := openOutput(name, exi.compress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, file, "skipped:", err)
+			continue
+		}
+
+		if exi.verbose {
+			logger.Println(file, "will be written to", name)
+		}
+
+		qexi := *exi
+		qexi.query = query
+		rows := qexi.export(db, output)
+
+		err = output.Close()
+		if err != nil {
+			writeFailed(err)
+		}
+		outFile.rows = rows
+		exi.outputs = append(exi.outputs, outFile)
+
+		if exi.verify {
+			err = exi.verifyOutput(name, rows)
+			if err != nil {
+				exitWith("failed", 1, err)
+			}
+		}
+
+		if exi.verbose {
+			logger.Println()
+			logger.Println(rows, "rows written to", name)
+		}
+		total += rows
+
+		// The remaining queries are not started once the maximum runtime is reached
+		if runtimeExceeded {
+			break
+		}
+	}
+
+	return total
+}
+
+// writeFailed reports an output write error, such as a full disk, and exits
+func writeFailed(err error) {
+	fatal(exitWriteError, fmt.Errorf("failed to write output: %w", err))
+}
+
+// checkWriteErr handles output write errors. A broken pipe means the consumer, such as
+// head, intentionally stopped reading so mycsv exits quietly.
+func checkWriteErr(err error) {
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) {
+		report.finish("pipe closed", 0, err)
+		abortUploads()
+		runCleanups()
+		os.Exit(0)
+	}
+	writeFailed(err)
+}
+
+// Pass the buck error catching
+func checkErr(e error) {
+	if e != nil {
+		fatal(exitInternalError, e)
+	}
+}
+
+// fatal prints err and exits with code, the report records the failure first and S3 uploads
+// are discarded. With -v it panics instead so the stack trace shows where the error came from.
+func fatal(code int, err error) {
+	if panicOnError {
+		report.finish("failed", code, err)
+		abortUploads()
+		runCleanups()
+		log.Panic(err)
+	}
+
+	exitWith("failed", code, err)
+}
+
+// exitWith prints err and exits with code once the report records status. S3 uploads still in
+// progress are discarded after the report, which may itself be uploaded, is finalized.
+func exitWith(status string, code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	report.finish(status, code, err)
+	abortUploads()
+	runCleanups()
+	os.Exit(code)
+}
+
+// atExit registers f to be run by runCleanups
+func atExit(f func()) {
+	cleanups = append(cleanups, f)
+}
+
+// runCleanups runs the registered cleanups once, most recent first
+func runCleanups() {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+}
+
+// readPasswordFD reads a password from file descriptor fd, one trailing newline is removed
+func readPasswordFD(fd int) (string, error) {
+	f := os.NewFile(uintptr(fd), "pass-fd")
+	if f == nil {
+		return "", errors.New("invalid file descriptor")
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	pwd := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(pwd, "\r"), nil
+}
+
+// decodeEscapes translates backslash escapes (\t, \r, \n, \0 & \\) in a flag value
+// to the characters they represent, other backslashes are left as is
+func decodeEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'n':
+				b.WriteByte('\n')
+			case '0':
+				b.WriteByte(0x00)
+			case '\\':
+				b.WriteByte('\\')
+			default:
+				b.WriteByte(s[i])
+				continue
+			}
+			i++
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// Catch signals
+func catchNotifications() {
+	state, err := terminal.GetState(int(os.Stdin.Fd()))
+	checkErr(err)
+
+	// Deal with SIGINT
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+
+	var timer time.Time
+	var stopping bool
+	go func() {
+		for sig := range sigChan {
+			// Prevent exiting on accidental signal send
+			if time.Now().Sub(timer) < time.Second*signalTimeout {
+				// Watching stops after the running export so its output is complete
+				if watchStop != nil && !stopping {
+					close(watchStop)
+					stopping = true
+					fmt.Fprintln(os.Stderr, "Stopping after the current export")
+					timer = time.Time{}
+					continue
+				}
+
+				terminal.Restore(int(os.Stdin.Fd()), state)
+				report.finish("interrupted", 0, nil)
+				abortUploads()
+				runCleanups()
+				os.Exit(0)
+			}
+
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, sig, "signal caught!")
+			fmt.Fprintf(os.Stderr, "Send signal again within %v seconds to exit\n", signalTimeout)
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, "")
+
+			timer = time.Now()
+		}
+	}()
+}
+
+// address returns the database's host:port, or its socket path when connecting over a socket
+func (dbi *dbInfo) address() string {
+	if dbi.socket != "" {
+		return dbi.socket
+	}
+
+	return dbi.host + ":" + dbi.port
+}
+
+// Create and return a database handle
+func (dbi *dbInfo) connect() (*sql.DB, error) {
+	// Set MySQL driver parameters
+	dbParameters := "charset=" + dbi.charset
+
+	// Append cleartext and tls parameters if TLS is specified
+	if dbi.tls == true {
+		dbParameters = dbParameters + "&allowCleartextPasswords=1&tls=" + dbi.tlsConfig
+	}
+
+	// Dialing gives up after the timeout instead of waiting on an unreachable host. Reads and
+	// writes only time out when asked to, a slow query returns nothing until its first row.
+	if dbi.timeout > 0 {
+		dbParameters = dbParameters + "&timeout=" + dbi.timeout.String()
+	}
+	if dbi.readTimeout > 0 {
+		dbParameters = dbParameters + "&readTimeout=" + dbi.readTimeout.String() + "&writeTimeout=" + dbi.readTimeout.String()
+	}
+
+	// Parsed times are written in RFC 3339 format with the offset of loc
+	if dbi.parseTime {
+		dbParameters = dbParameters + "&parseTime=true&loc=" + url.QueryEscape(dbi.loc)
+	}
+
+	// The driver sets unknown parameters as session variables on every connection
+	if dbi.timeZone != "" {
+		dbParameters = dbParameters + "&time_zone=" + url.QueryEscape("'"+dbi.timeZone+"'")
+	}
+
+	address := dbi.network + "(" + dbi.host + ":" + dbi.port + ")"
+	if dbi.socket != "" {
+		address = "unix(" + dbi.socket + ")"
+	}
+
+	dsn := dbi.user + ":" + dbi.pass + "@" + address + "/?" + dbParameters
+	if dbi.driver == "postgres" {
+		dsn = dbi.postgresDSN()
+	}
+
+	db, err := sql.Open(dbi.driver, dsn)
+	checkErr(err)
+
+	// The init command runs as each pooled connection is opened, starting with the Ping
+	if dbi.initCmd != "" {
+		connector, err := db.Driver().(driver.DriverContext).OpenConnector(dsn)
+		checkErr(err)
+		db.Close()
+		db = sql.OpenDB(&initConnector{Connector: connector, command: dbi.initCmd})
+	}
+
+	// Ping database to verify credentials, the timeout covers the handshake as well as dialing
+	ctx := context.Background()
+	if dbi.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dbi.timeout)
+		defer cancel()
+	}
+	err = db.PingContext(ctx)
+
+	return db, err
+}
+
+// readRows executes a query and sends each row over a channel to be consumed
+func readRows(db *sql.DB, exi exportInfo, colChan chan []column, dataChan chan []sql.RawBytes, quitChan chan bool, goChan chan bool) {
+	// Keep idle proxies from dropping the connection during long query planning phases
+	stopKeepalive := make(chan bool)
+	if exi.keepalive > 0 {
+		go keepAlive(db, exi.keepalive, stopKeepalive)
+	}
+
+	// Warnings belong to a session so the query must run on a pinned connection to read them back
+	var conn *sql.Conn
+	var rows *sql.Rows
+	var err error
+	if exi.warnings {
+		conn, err = db.Conn(context.Background())
+		checkErr(err)
+		defer conn.Close()
 	}
 
-	// Flush remaining CSV writer contents
-	w.Flush()
-	err := w.Error()
-	checkErr(err)
+	// Paged exports run a short query for each page, the first fetches from the start
+	query := exi.query
+	if exi.pageSize > 0 {
+		query = pageQuery(exi.query, exi.orderKey, exi.pageSize, false)
+	}
+	runQuery := func(q string, args ...interface{}) error {
+		if conn != nil {
+			rows, err = conn.QueryContext(exi.ctx, q, args...)
+		} else {
+			rows, err = db.QueryContext(exi.ctx, q, args...)
+		}
+		return err
+	}
+	// queryFailed handles the first query failing, nothing has been streamed yet so there is no
+	// partial output to keep. Failures after rows were written go straight to fatal.
+	queryFailed := func(err error) {
+		if exi.ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("maximum runtime exceeded before the query returned any rows")
+			exitWith("timed out", exitTimedOut, err)
+		}
+		fatal(exitQueryError, err)
+	}
+
+	// Lock wait timeouts & deadlocks can happen after rows have been written, paged exports
+	// resume after the last key read but anything else has to fail
+	var retries int
+	retryLock := func(err error) bool {
+		if !lockError(err) {
+			return false
+		}
+		if exi.pageSize == 0 {
+			fatal(exitQueryError, fmt.Errorf("%s\nThe export was interrupted by a lock wait timeout or deadlock, use -page-size and -order-key so it can resume from the last key", err))
+		}
+		if retries >= exi.lockRetries {
+			fatal(exitQueryError, fmt.Errorf("%s\nThe export was interrupted by a lock wait timeout or deadlock %d times", err, retries+1))
+		}
+
+		retries++
+		logger.Printf("Warning: %s, resuming from the last key (retry %d of %d)\n", err, retries, exi.lockRetries)
+		time.Sleep(time.Duration(retries) * time.Second)
+		return true
+	}
+
+	for err = runQuery(query); err != nil; err = runQuery(query) {
+		if !retryLock(err) {
+			queryFailed(err)
+		}
+	}
+	// A page query cut off by the maximum runtime leaves no rows to close
+	defer func() {
+		if rows != nil {
+			rows.Close()
+		}
+	}()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		fatal(exitQueryError, err)
+	}
+
+	// Only the leading columns are written but every column is still scanned
+	width := len(cols)
+	if exi.maxCols > 0 && exi.maxCols < width {
+		width = exi.maxCols
+		if exi.verbose {
+			logger.Printf("Writing the first %d of %d columns\n", width, len(cols))
+		}
+	}
+
+	// Joins can return the same column name more than once
+	renamed, dups := dedupNames(cols)
+	if exi.dedup {
+		cols = renamed
+	} else if exi.verbose {
+		for _, dup := range dups {
+			logger.Printf("Warning: column name %q is repeated, use -dedup-headers to rename repeats\n", dup)
+		}
+	}
+
+	if exi.header && !exi.appending && exi.verbose && exi.format == "csv" {
+		checkHeaders(cols[:width], exi.delimiter, exi.quote)
+	}
+
+	// Type based options fall back to treating columns as text when the driver can not say
+	types, err := rows.ColumnTypes()
+	columns, complete := resolveColumns(cols, types, err)
+	if !complete && exi.verbose {
+		logger.Println("Warning: column type information is incomplete, columns without a type are treated as text")
+	}
+
+	// The schema is written once before any rows are streamed
+	if exi.schema != nil {
+		err = writeSchema(exi.schema, columns[:width])
+		if err == nil {
+			err = exi.schema.Close()
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// The order key's value in the last row of a page is where the next page starts
+	key := -1
+	var keyNumeric bool
+	if exi.pageSize > 0 {
+		numeric := typeMask(columns, numericTypes...)
+		for i, col := range cols {
+			if columnMatch(col, exi.orderKey, exi.colsCase) {
+				key = i
+				keyNumeric = numeric[i]
+			}
+		}
+		if key < 0 {
+			err = fmt.Errorf("order key %q not found in query results", exi.orderKey)
+			exitWith("failed", 1, err)
+		}
+	}
+
+	// Column information is always sent first, writeCSV() decides if names are written as a header line
+	colChan <- columns[:width]
+
+	// Need to scan into empty interface since we don't know how many columns a query might return
+	scanVals := make([]interface{}, len(cols))
+	vals := make([]sql.RawBytes, len(cols))
+	for i := range vals {
+		scanVals[i] = &vals[i]
+	}
+
+	first := true
+	var pageRows int
+	var lastKey []byte
+	var keyRead bool
+	var keyNull bool
+
+	// resume runs the query for the page after the last key read, returning false if the
+	// maximum runtime has been reached
+	resume := func() bool {
+		rows.Close()
+		pageRows = 0
+
+		if keyNull {
+			err := fmt.Errorf("order key %q is NULL where the next page starts, the key must not be NULL", exi.orderKey)
+			exitWith("failed", 1, err)
+		}
+
+		for {
+			q, args := query, []interface{}(nil)
+			if keyRead {
+				q, args = pageQuery(exi.query, exi.orderKey, exi.pageSize, true), []interface{}{keyArg(lastKey, keyNumeric)}
+			}
+
+			err := runQuery(q, args...)
+			if err == nil {
+				return true
+			}
+			if exi.ctx.Err() == context.DeadlineExceeded {
+				runtimeExceeded = true
+				return false
+			}
+			if !retryLock(err) {
+				fatal(exitQueryError, err)
+			}
+		}
+	}
+
+	for {
+		if !rows.Next() {
+			// The rows read before the maximum runtime was reached are kept
+			err = rows.Err()
+			if err != nil && exi.ctx.Err() == context.DeadlineExceeded {
+				runtimeExceeded = true
+				break
+			}
+			if err != nil && retryLock(err) {
+				if !resume() {
+					break
+				}
+				continue
+			}
+			if err != nil {
+				fatal(exitQueryError, err)
+			}
+
+			// A short page is the last one
+			if exi.pageSize == 0 || pageRows < exi.pageSize {
+				break
+			}
+
+			if !resume() {
+				break
+			}
+			continue
+		}
+
+		// Streaming has begun
+		if first {
+			close(stopKeepalive)
+			first = false
+		}
+
+		// Scanning into []byte makes the driver copy each value, so rows can be queued
+		// without waiting for writeCSV() to finish with them
+		if exi.rowBuffer > 0 {
+			vals = make([]sql.RawBytes, len(cols))
+			for i := range vals {
+				scanVals[i] = (*[]byte)(&vals[i])
+			}
+		}
+
+		err := rows.Scan(scanVals...)
+		if err != nil {
+			fatal(exitQueryError, err)
+		}
+
+		// The key is copied before the row is handed off since the scan buffer is reused
+		if key >= 0 {
+			pageRows++
+			keyRead = true
+			keyNull = vals[key] == nil
+			lastKey = append(lastKey[:0], vals[key]...)
+		}
+
+		dataChan <- vals[:width]
+		if exi.rowBuffer > 0 {
+			continue
+		}
+
+		// Block and wait for writeRows() to signal back it has consumed the data
+		// This is necessary because sql.RawBytes is a memory pointer and when rows.Next()
+		// loops and change the memory address before writeRows can properly process the values
+		<-goChan
+	}
+
+	if first {
+		close(stopKeepalive)
+	}
+
+	// The result set must be closed before the connection can run another statement
+	if conn != nil {
+		rows.Close()
+
+		warnings, err := showWarnings(conn)
+		if err != nil {
+			logger.Println("Warning: unable to read query warnings:", err)
+		}
+		for _, w := range warnings {
+			logger.Printf("Query %s %d: %s\n", w.level, w.code, w.message)
+		}
+	}
+
+	close(dataChan)
+	quitChan <- true
+}
+
+// keepAlive pings the server on a separate pooled connection every interval until stop is closed
+func keepAlive(db *sql.DB, interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := db.Ping(); err != nil {
+				logger.Println("Warning: keepalive ping failed:", err)
+			}
+		}
+	}
+}
+
+// metadataColumns returns the names and values of the requested provenance columns
+func (exi *exportInfo) metadataColumns() ([]sql.RawBytes, []sql.RawBytes) {
+	var names, vals []sql.RawBytes
+	if exi.addHost {
+		names = append(names, []byte("source_host"))
+		vals = append(vals, []byte(exi.host))
+	}
+	if exi.addDB {
+		names = append(names, []byte("source_db"))
+		vals = append(vals, exi.database)
+	}
+	if exi.addQuery {
+		names = append(names, []byte("source_query"))
+		vals = append(vals, []byte(strings.TrimSpace(exi.query)))
+	}
+
+	return names, vals
+}
+
+// checkHeaders warns when column names contain characters that make the header line ambiguous
+func checkHeaders(cols []string, delimiter string, quote string) {
+	for _, col := range cols {
+		if (delimiter != "" && strings.Contains(col, delimiter)) || (quote != "" && strings.Contains(col, quote)) || strings.ContainsAny(col, "\r\n") {
+			logger.Printf("Warning: column name %q contains a delimiter, quote or newline character, the header line may need special parsing\n", col)
+		}
+	}
+}
+
+// writeCSV reads from a channel and writes CSV output
+func writeCSV(w recordWriter, exi exportInfo, colChan chan []column, dataChan chan []sql.RawBytes, goChan chan bool) uint {
+	var rowsWritten uint
+	var verboseCount uint
+
+	// The status line is refreshed every second
+	var tick <-chan time.Time
+	started := time.Now()
+	if exi.progress != nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// readRows() sends column information before any rows
+	columns := <-colChan
+	cols := columnNames(columns)
+
+	if exi.format == "raw" && len(columns) != 1 {
+		err := fmt.Errorf("-raw requires a single column query, the query returned %d columns", len(columns))
+		exitWith("failed", 1, err)
+	}
+
+	// The name & content columns are found before any file is written
+	if exi.format == "explode" {
+		name, content, err := explodeColumns(cols, exi.explodeName, exi.explodeContent, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		if ew, ok := w.(*ExplodeWriter); ok {
+			ew.Name, ew.Content = name, content
+		}
+	}
+
+	if exi.print0 && len(columns) > 1 {
+		logger.Println("Warning: -print0 is intended for single column queries, fields will still be delimited")
+	}
+
+	// Resolve which columns have whitespace trimmed
+	var trimMask []bool
+	if exi.trim || len(exi.trimCols) > 0 {
+		var err error
+		trimMask, err = columnMask(cols, exi.trimCols, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		if exi.trim {
+			for i := range trimMask {
+				trimMask[i] = true
+			}
+		}
+	}
+
+	// Resolve which columns are converted from MySQL geometry to WKT
+	var wktMask []bool
+	if exi.geometry == "wkt" {
+		wktMask = typeMask(columns, "GEOMETRY")
+	}
+
+	// Resolve which binary columns are encoded
+	var binaryMask []bool
+	if exi.binary != "raw" {
+		binaryMask = typeMask(columns, "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB")
+	}
+
+	// Resolve which numeric columns are reformatted
+	var floatMask []bool
+	if exi.floatFmt != "" {
+		floatMask = typeMask(columns, "DECIMAL", "FLOAT", "DOUBLE")
+	}
+
+	// Resolve which numeric columns have thousands separators added, YEAR is left alone
+	var numberMask []bool
+	if exi.numberFmt != "" {
+		numberMask = typeMask(columns, "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE",
+			"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT")
+	}
+
+	// Resolve which BIT columns are written as booleans
+	var boolMask []bool
+	if exi.boolFmt != "" {
+		boolMask = typeMask(columns, "BIT")
+	}
+
+	// Resolve which columns are padded
+	var padMask []*padSpec
+	if len(exi.pads) > 0 {
+		var err error
+		padMask, err = padColumns(cols, exi.pads, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+	}
+
+	// The first rows are checked against their declared types before anything converts them
+	var checker *typeChecker
+	if exi.typecheck > 0 {
+		checker = newTypeChecker(columns, exi.typecheck)
+	}
+
+	// Column statistics are gathered from the values as written
+	var profiles []*columnProfile
+	if exi.profile {
+		profiles = newProfiles(cols)
+	}
+
+	// A coalesced column is written after the query's columns
+	var coalesce *coalescer
+	outCols := cols
+	if len(exi.coalesceSources) > 0 {
+		var err error
+		coalesce, err = newCoalescer(cols, exi.coalesceName, exi.coalesceSources, exi.coalesceDrop, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		outCols = coalesce.header(cols)
+	}
+
+	// Unpivoted rows are written with the key columns followed by a measure's name and value
+	var unpivot *unpivoter
+	if len(exi.unpivotMeasures) > 0 {
+		var err error
+		unpivot, err = newUnpivoter(cols, exi.unpivotKeys, exi.unpivotMeasures, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		outCols = unpivot.header(cols)
+	}
+
+	// Metadata columns are prepended to the header and every row
+	metaNames, metaVals := exi.metadataColumns()
+	var record []sql.RawBytes
+	if len(metaNames) > 0 {
+		record = make([]sql.RawBytes, len(metaNames)+len(outCols))
+	}
+
+	// The row hash is appended after the query's columns
+	var hasher hash.Hash
+	switch exi.hash {
+	case "xxhash":
+		hasher = xxhash.New()
+	case "sha1":
+		hasher = sha1.New()
+	}
+	if hasher != nil {
+		record = make([]sql.RawBytes, len(metaNames)+len(outCols)+1)
+	}
+
+	header := prependFields(make([]sql.RawBytes, len(metaNames)+len(outCols)), metaNames, outCols)
+	if hasher != nil {
+		header = append(header, []byte(exi.hashColumn))
+	}
+	if exi.header && !exi.appending {
+		_, err := w.WriteHeader(header)
+		checkWriteErr(err)
+	}
+
+	// A separate header file is written in the same format as the data
+	if exi.headerOut != nil {
+		hexi := exi
+		hexi.trimFinal = false
+		hw := hexi.newWriter(exi.headerOut)
+		_, err := hw.WriteHeader(header)
+		if err == nil {
+			err = hw.Close()
+		}
+		if err == nil {
+			err = exi.headerOut.Close()
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// Rows are buffered from here on when sorting or reversing, the header has already been written
+	var sorter *sortingWriter
+	var sortField int
+	if exi.sortCol != "" {
+		mask, err := columnMask(cols, []string{exi.sortCol}, exi.colsCase)
+		if err != nil {
+			exitWith("failed", 1, err)
+		}
+		numeric := typeMask(columns, numericTypes...)
+		for i := range mask {
+			if mask[i] {
+				sorter = newSortingWriter(w, len(metaNames)+i, numeric[i], exi.sortDesc, exi.sortMax)
+				sortField = i
+				w = sorter
+				break
+			}
+		}
+	}
+	if exi.reverse {
+		w = newReversingWriter(w, exi.reverseMax)
+	}
+
+	// The control file lists the metadata and hash columns along with the query's columns
+	if exi.sqlldr != nil {
+		var ctlCols []column
+		for _, name := range metaNames {
+			ctlCols = append(ctlCols, column{name: string(name), dbType: "TEXT"})
+		}
+		if unpivot != nil {
+			ctlCols = append(ctlCols, unpivot.columns(columns)...)
+		} else if coalesce != nil {
+			ctlCols = append(ctlCols, coalesce.columns(columns)...)
+		} else {
+			ctlCols = append(ctlCols, columns...)
+		}
+		if hasher != nil {
+			ctlCols = append(ctlCols, column{name: exi.hashColumn, dbType: "CHAR"})
+		}
+
+		err := writeControlFile(exi.sqlldr, exi.ctlTable, exi.ctlInfile, exi, ctlCols)
+		if err == nil {
+			err = exi.sqlldr.Close()
+		}
+		if err != nil {
+			writeFailed(err)
+		}
+	}
+
+	// Smooth read pressure on the server
+	var th *throttle
+	if exi.throttle > 0 {
+		th = newThrottle(exi.throttle)
+	}
+
+	// Range over row results from readRows()
+	for data := range dataChan {
+		if th != nil {
+			th.wait()
+		}
+
+		// Finish the current output file and start the next once it is due, every file gets a header
+		if exi.rotate != nil && exi.rotate.due() {
+			err := w.Close()
+			checkWriteErr(err)
+
+			err = exi.rotate.rotate()
+			if err != nil {
+				writeFailed(err)
+			}
+			if exi.verbose {
+				logger.Println()
+				logger.Println("Output rotated to", exi.rotate.files[len(exi.rotate.files)-1].name)
+			}
+
+			var dest io.Writer = exi.rotate
+			if exi.progress != nil {
+				dest = exi.progress
+			}
+			w = exi.newWriter(dest)
+			if exi.header {
+				_, err = w.WriteHeader(header)
+				checkWriteErr(err)
+			}
+		}
+
+		// Hash the values as read so the hash does not depend on output options
+		var sum sql.RawBytes
+		if hasher != nil {
+			sum = rowHash(hasher, data)
+		}
+
+		if checker != nil && checker.check(data) {
+			checker.report()
+			checker = nil
+		}
+
+		// Rows already in the previous export are skipped
+		if exi.previous != nil {
+			if _, ok := exi.previous[string(sum)]; ok {
+				if exi.rowBuffer == 0 {
+					goChan <- true
+				}
+				continue
+			}
+		}
+
+		// Rows are sorted by the value read, as the server would, not how it is formatted
+		if sorter != nil {
+			sorter.setKey(data[sortField])
+		}
+
+		if trimMask != nil {
+			trimFields(data, trimMask)
+		}
+		if exi.nullIf != nil {
+			nullFields(data, exi.nullIf, exi.nullFold)
+		}
+		if wktMask != nil {
+			wktFields(data, wktMask)
+		}
+		if binaryMask != nil {
+			encodeFields(data, binaryMask, exi.binary)
+		}
+		if floatMask != nil {
+			formatFloats(data, floatMask, exi.floatFmt)
+		}
+		if boolMask != nil {
+			formatBools(data, boolMask, exi.boolFmt)
+		}
+		if exi.numberFmt != "" {
+			formatNumbers(data, numberMask, exi.numberFmt)
+		}
+		if padMask != nil {
+			padFields(data, padMask)
+		}
+		if profiles != nil {
+			profileFields(profiles, data)
+		}
+
+		// An unpivoted row is written once for each measure
+		writes := 1
+		if unpivot != nil {
+			writes = len(unpivot.measures)
+		}
+		for m := 0; m < writes; m++ {
+			out := data
+			if coalesce != nil {
+				out = coalesce.record(data)
+			}
+			if unpivot != nil {
+				out = unpivot.record(data, m)
+			}
+			if record != nil {
+				out = prependFields(record, metaVals, out)
+			}
+			if hasher != nil {
+				out[len(out)-1] = sum
+			}
+
+			// Format the data to CSV and write
+			size, err := w.Write(out)
+			checkWriteErr(err)
+			report.addRow()
+			if exi.rotate != nil {
+				exi.rotate.count(size)
+			}
+
+			// Visual write indicator when verbose is enabled, a status line on the timer or a dot per 10,000 rows
+			rowsWritten++
+			if tick != nil {
+				select {
+				case <-tick:
+					logger.Status(rowsWritten, exi.progress.n+int64(size), time.Since(started))
+				default:
+				}
+			} else if exi.verbose {
+				verboseCount++
+				if verboseCount == 10000 {
+					logger.Progress(rowsWritten)
+					verboseCount = 0
+				}
+			}
+
+			// Flush CSV writer contents once it reaches the flush size
+			if size >= exi.flushSize {
+				if exi.verbose {
+					logger.Flush(rowsWritten, size)
+				}
+				w.Flush()
+				err = w.Error()
+				checkWriteErr(err)
+			}
+		}
+
+		// Signal back to readRows() it can loop and scan the next row, copied rows need no handshake
+		if exi.rowBuffer == 0 {
+			goChan <- true
+		}
+	}
+
+	// Finish and flush remaining CSV writer contents
+	err := w.Close()
+	checkWriteErr(err)
+
+	// Fewer rows than the sample size were returned
+	if checker != nil {
+		checker.report()
+	}
+
+	if profiles != nil {
+		logger.Profile(profiles)
+	}
 
 	return rowsWritten
 }
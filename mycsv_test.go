@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubResult is the canned result a stubDB returns for a query. Values are []byte or nil,
+// delay is slept before each row and the end of the rows, run is called each time the query runs.
+type stubResult struct {
+	cols  []string
+	types []string
+	rows  [][]driver.Value
+	err   error
+	delay time.Duration
+	run   func()
+}
+
+// newStubDB returns a *sql.DB that answers the queries in results and fails any other
+func newStubDB(results map[string]stubResult) *sql.DB {
+	return sql.OpenDB(stubConnector{results})
+}
+
+type stubConnector struct {
+	results map[string]stubResult
+}
+
+func (c stubConnector) Connect(context.Context) (driver.Conn, error) {
+	return stubConn(c), nil
+}
+
+func (c stubConnector) Driver() driver.Driver {
+	return stubDriver{}
+}
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("stubDriver can only be used through newStubDB")
+}
+
+type stubConn stubConnector
+
+func (c stubConn) Prepare(query string) (driver.Stmt, error) {
+	return stubStmt{results: c.results, query: query}, nil
+}
+
+func (stubConn) Close() error {
+	return nil
+}
+
+func (stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stubConn does not support transactions")
+}
+
+type stubStmt struct {
+	results map[string]stubResult
+	query   string
+}
+
+func (stubStmt) Close() error {
+	return nil
+}
+
+func (stubStmt) NumInput() int {
+	return -1
+}
+
+func (s stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("unexpected exec %q", s.query)
+}
+
+func (s stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	res, ok := s.results[s.query]
+	if !ok {
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+	if res.run != nil {
+		res.run()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	return &stubRows{result: res}, nil
+}
+
+type stubRows struct {
+	result stubResult
+	next   int
+}
+
+func (r *stubRows) Columns() []string {
+	return r.result.cols
+}
+
+func (r *stubRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.result.types) {
+		return r.result.types[i]
+	}
+	return ""
+}
+
+func (r *stubRows) Close() error {
+	return nil
+}
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	time.Sleep(r.result.delay)
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+
+	return nil
+}
+
+// benchRow stands in for the driver's row buffer which sql.RawBytes values alias
+var benchRow = []sql.RawBytes{[]byte("12345"), []byte("Lorem ipsum dolor sit amet"), []byte("2017-01-01 00:00:00"), nil}
+
+// BenchmarkRowHandoff measures passing aliased rows one at a time with the goChan handshake
+func BenchmarkRowHandoff(b *testing.B) {
+	dataChan := make(chan []sql.RawBytes)
+	goChan := make(chan bool)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			dataChan <- benchRow
+			<-goChan
+		}
+		close(dataChan)
+	}()
+
+	for range dataChan {
+		goChan <- true
+	}
+}
+
+// BenchmarkRowCopy measures passing copied rows over a buffered channel without a handshake
+func BenchmarkRowCopy(b *testing.B) {
+	dataChan := make(chan []sql.RawBytes, 1000)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			vals := make([]sql.RawBytes, len(benchRow))
+			for n, field := range benchRow {
+				if field != nil {
+					vals[n] = append([]byte(nil), field...)
+				}
+			}
+			dataChan <- vals
+		}
+		close(dataChan)
+	}()
+
+	for range dataChan {
+	}
+}
+
+// testExport returns an exportInfo for the default CSV output of query
+func testExport(query string) exportInfo {
+	return exportInfo{query: query, header: true, format: "csv", delimiter: ",", quote: `"`, escape: `\`, terminator: "\n", nullString: `\N`, ctx: context.Background()}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	var runs int
+	watchStop = make(chan struct{})
+	defer func() { watchStop = nil }()
+	db := newStubDB(map[string]stubResult{"select a": {
+		cols: []string{"a"},
+		rows: [][]driver.Value{{[]byte("1")}, {[]byte("2")}, {[]byte("3")}},
+		run: func() {
+			if runs++; runs == 2 {
+				close(watchStop)
+			}
+		},
+	}})
+	defer db.Close()
+
+	r, err := newSplitOutput(filepath.Join(dir, "out.csv"), "none", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerOut := &bytes.Buffer{}
+	exi := testExport("select a")
+	exi.rotate = r
+	exi.headerOut = nopWriteCloser{headerOut}
+
+	if rows := exi.watch(db, r, time.Millisecond); rows != 6 {
+		t.Errorf("rows=%d want 6", rows)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headerOut.String(); got != "\"a\"\n" {
+		t.Errorf("header file got=%q want one header", got)
+	}
+	want := map[string]string{"out.000.csv": "\"a\"\n\"1\"\n\"2\"\n", "out.001.csv": "\"a\"\n\"3\"\n\"1\"\n", "out.002.csv": "\"a\"\n\"2\"\n\"3\"\n"}
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		} else if string(got) != content {
+			t.Errorf("%s: got=%q want=%q", name, got, content)
+		}
+	}
+}
+
+func TestExportSortFormatted(t *testing.T) {
+	db := newStubDB(map[string]stubResult{"select n": {
+		cols:  []string{"n"},
+		types: []string{"INT"},
+		rows:  [][]driver.Value{{[]byte("1000")}, {[]byte("200")}, {nil}, {[]byte("30000")}},
+	}})
+	defer db.Close()
+
+	exi := testExport("select n")
+	exi.sortCol = "n"
+	exi.sortMax = 10
+	exi.numberFmt = "group"
+	b := &bytes.Buffer{}
+	exi.export(db, b)
+
+	if got, want := b.String(), "\"n\"\n\\N\n\"200\"\n\"1,000\"\n\"30,000\"\n"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestExportMaxRuntime(t *testing.T) {
+	query := "select id from t"
+	db := newStubDB(map[string]stubResult{
+		pageQuery(query, "id", 2, false): {cols: []string{"id"}, types: []string{"INT"}, rows: [][]driver.Value{{[]byte("1")}, {[]byte("2")}}, delay: 20 * time.Millisecond},
+		pageQuery(query, "id", 2, true):  {cols: []string{"id"}, types: []string{"INT"}},
+	})
+	defer db.Close()
+	defer func() { runtimeExceeded = false }()
+
+	// The deadline passes while the first page is read so the next is never run
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	exi := testExport(query)
+	exi.ctx = ctx
+	exi.pageSize = 2
+	exi.orderKey = "id"
+	b := &bytes.Buffer{}
+
+	if rows := exi.export(db, b); rows != 2 {
+		t.Errorf("rows=%d want 2", rows)
+	}
+	if got, want := b.String(), "\"id\"\n\"1\"\n\"2\"\n"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+	if !runtimeExceeded {
+		t.Error("runtimeExceeded=false want true")
+	}
+	if status, code := exportStatus(runtimeExceeded, false); status != "timed out" || code != exitTimedOut {
+		t.Errorf("got=%q, %d want=%q, %d", status, code, "timed out", exitTimedOut)
+	}
+}
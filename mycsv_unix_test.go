@@ -0,0 +1,42 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestReadPasswordFD(t *testing.T) {
+	for n, tt := range []struct{ Input, Output string }{
+		{Input: "secret", Output: "secret"},
+		{Input: "secret\n", Output: "secret"},
+		{Input: "secret\r\n", Output: "secret"},
+		{Input: "secret\n\n", Output: "secret\n"},
+		{Input: "", Output: ""},
+	} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s\n", err)
+		}
+		w.WriteString(tt.Input)
+		w.Close()
+
+		// readPasswordFD closes the descriptor it is given so r must not own it too
+		fd, err := syscall.Dup(int(r.Fd()))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s\n", err)
+		}
+		r.Close()
+
+		got, err := readPasswordFD(fd)
+		if err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3PartSize is the multipart upload part size, S3 allows 10,000 parts so objects can reach 640GB
+const s3PartSize = 64 * 1024 * 1024
+
+// uploads holds the S3 uploads that have not been closed yet, abortUploads discards them
+var uploads []*s3Output
+
+// createOutput opens the CSV output destination, dispatching on the URL scheme of name.
+// Output is only complete once the returned io.WriteCloser has been closed successfully.
+func createOutput(name string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(name, "gs://"):
+		return createGCSOutput(name)
+	case strings.HasPrefix(name, "s3://"):
+		return createS3Output(name)
+	default:
+		return createFileOutput(name)
+	}
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing, for compressing standard out
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// An outputFile records an output file written by the export for the -manifest
+type outputFile struct {
+	name  string
+	rows  uint
+	bytes *countingOutput
+}
+
+// countingOutput counts the bytes written to an output destination
+type countingOutput struct {
+	io.WriteCloser
+	n int64
+}
+
+// Write writes p to the destination and adds the bytes written to the count
+func (c *countingOutput) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// openOutput creates the named output with the requested compression. The returned outputFile
+// counts the bytes stored, after compression, and has its rows set once the export finishes.
+func openOutput(name string, compress string) (io.WriteCloser, *outputFile, error) {
+	output, err := createOutput(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counter := &countingOutput{WriteCloser: output}
+	output, err = compressOutput(counter, name, compress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := &outputFile{name: name, bytes: counter}
+	report.addFile(file)
+
+	return output, file, nil
+}
+
+// removeOutput deletes a finished local output file along with any index compress wrote for it
+func removeOutput(name string, compress string) error {
+	if compress == "bgzip" {
+		if err := os.Remove(name + ".gzi"); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(name)
+}
+
+// createFileOutput creates a local file, refusing to overwrite an existing one
+func createFileOutput(name string) (io.WriteCloser, error) {
+	f, err := os.Open(name)
+	if err == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s already exists!\nPlease remove it or use a different filename", name)
+	}
+
+	return os.Create(name)
+}
+
+// objectURL reports if name is a cloud storage object rather than a local file
+func objectURL(name string) bool {
+	return strings.HasPrefix(name, "gs://") || strings.HasPrefix(name, "s3://")
+}
+
+// splitObjectURL splits a scheme://bucket/object URL into its bucket and object names
+func splitObjectURL(name string, scheme string) (string, string, error) {
+	path := strings.TrimPrefix(name, scheme)
+	i := strings.Index(path, "/")
+	if i < 1 || i == len(path)-1 {
+		return "", "", fmt.Errorf("%s is not a valid %sbucket/object URL", name, scheme)
+	}
+
+	return path[:i], path[i+1:], nil
+}
+
+// gcsOutput streams to a Google Cloud Storage object. The object is only created when
+// Close succeeds, an upload abandoned before Close leaves nothing behind.
+type gcsOutput struct {
+	*storage.Writer
+	client *storage.Client
+}
+
+// createGCSOutput opens a writer to a GCS object using Application Default Credentials
+func createGCSOutput(name string) (io.WriteCloser, error) {
+	bucket, object, err := splitObjectURL(name, "gs://")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to overwrite an existing object, matching the local file behavior
+	obj := client.Bucket(bucket).Object(object).If(storage.Conditions{DoesNotExist: true})
+
+	return &gcsOutput{Writer: obj.NewWriter(ctx), client: client}, nil
+}
+
+// Close finalizes the GCS object
+func (g *gcsOutput) Close() error {
+	err := g.Writer.Close()
+	g.client.Close()
+
+	return err
+}
+
+// s3Output streams to an S3 object with a multipart upload. The object is only created when
+// Close succeeds, Abort discards the parts uploaded so far.
+type s3Output struct {
+	*io.PipeWriter
+	done   chan error
+	closed bool
+}
+
+// createS3Output starts a multipart upload to an S3 object using the default AWS credential
+// chain. S3 has no conditional create so an existing object is replaced.
+func createS3Output(name string) (io.WriteCloser, error) {
+	bucket, key, err := splitObjectURL(name, "s3://")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg), func(u *manager.Uploader) {
+		u.PartSize = s3PartSize
+	})
+
+	// The uploader reads the parts from a pipe fed by Write
+	r, w := io.Pipe()
+	out := &s3Output{PipeWriter: w, done: make(chan error, 1)}
+	go func() {
+		_, err := uploader.Upload(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: r})
+		r.CloseWithError(err)
+		out.done <- err
+	}()
+	uploads = append(uploads, out)
+
+	return out, nil
+}
+
+// Close completes the multipart upload and waits for S3 to create the object
+func (o *s3Output) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	o.PipeWriter.Close()
+
+	return <-o.done
+}
+
+// Abort fails the upload, which has S3 discard the parts uploaded so far
+func (o *s3Output) Abort() {
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.PipeWriter.CloseWithError(errors.New("export failed"))
+	<-o.done
+}
+
+// abortUploads discards the S3 uploads of a failed or interrupted export
+func abortUploads() {
+	for _, o := range uploads {
+		o.Abort()
+	}
+}
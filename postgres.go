@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresPort is the default port used with -driver=postgres when -port is not given
+const postgresPort = "5432"
+
+// postgresDSN returns a lib/pq connection URL for dbi. The database defaults to the user name.
+func (dbi *dbInfo) postgresDSN() string {
+	params := url.Values{}
+	params.Set("sslmode", "disable")
+	if dbi.tls {
+		params.Set("sslmode", "require")
+	}
+
+	// A CA verifies the server certificate & host name, a client certificate alone verifies
+	// against the system CAs
+	if dbi.tlsCA != "" {
+		params.Set("sslmode", "verify-full")
+		params.Set("sslrootcert", dbi.tlsCA)
+	}
+	if dbi.tlsCert != "" {
+		params.Set("sslcert", dbi.tlsCert)
+		params.Set("sslkey", dbi.tlsKey)
+		if dbi.tlsCA == "" && !dbi.tlsSkip {
+			params.Set("sslmode", "verify-full")
+		}
+	}
+	if dbi.charset != "binary" {
+		params.Set("client_encoding", dbi.charset)
+	}
+	if dbi.timeout > 0 {
+		params.Set("connect_timeout", strconv.Itoa(int(dbi.timeout.Seconds())))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dbi.user, dbi.pass),
+		Host:     net.JoinHostPort(dbi.host, dbi.port),
+		RawQuery: params.Encode(),
+	}
+
+	return dsn.String()
+}
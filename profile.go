@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// hllPrecision sets 2^14 registers per column, about 16KB, for a standard error near 0.8%
+const hllPrecision = 14
+
+// A hyperLogLog estimates the number of distinct values added to it in fixed memory
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// newHyperLogLog returns an empty hyperLogLog
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Add records a value
+func (h *hyperLogLog) Add(value []byte) {
+	x := xxhash.Sum64(value)
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values, small counts use linear counting
+func (h *hyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// A columnProfile accumulates -profile statistics for a single column
+type columnProfile struct {
+	name     string
+	nonNull  uint64
+	minLen   int
+	maxLen   int
+	distinct *hyperLogLog
+}
+
+// newProfiles returns an empty profile for each column
+func newProfiles(cols []sql.RawBytes) []*columnProfile {
+	profiles := make([]*columnProfile, len(cols))
+	for i, col := range cols {
+		profiles[i] = &columnProfile{name: string(col), distinct: newHyperLogLog()}
+	}
+
+	return profiles
+}
+
+// profileFields adds a row's values to the column profiles
+func profileFields(profiles []*columnProfile, record []sql.RawBytes) {
+	for i, field := range record {
+		if field == nil {
+			continue
+		}
+
+		p := profiles[i]
+		if p.nonNull == 0 || len(field) < p.minLen {
+			p.minLen = len(field)
+		}
+		if len(field) > p.maxLen {
+			p.maxLen = len(field)
+		}
+		p.nonNull++
+		p.distinct.Add(field)
+	}
+}
+
+// profileTable returns the profile summary as a header and a row for each column
+func profileTable(profiles []*columnProfile) ([]sql.RawBytes, [][]sql.RawBytes) {
+	header := []sql.RawBytes{[]byte("column"), []byte("non_null"), []byte("min_length"), []byte("max_length"), []byte("approx_distinct")}
+
+	rows := make([][]sql.RawBytes, len(profiles))
+	for i, p := range profiles {
+		row := []sql.RawBytes{[]byte(p.name), strconv.AppendUint(nil, p.nonNull, 10), nil, nil, strconv.AppendUint(nil, p.distinct.Count(), 10)}
+		if p.nonNull > 0 {
+			row[2] = strconv.AppendInt(nil, int64(p.minLen), 10)
+			row[3] = strconv.AppendInt(nil, int64(p.maxLen), 10)
+		}
+		rows[i] = row
+	}
+
+	return header, rows
+}
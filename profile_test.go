@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+
+		got := float64(h.Count())
+		if got < float64(n)*0.97 || got > float64(n)*1.03 {
+			t.Errorf("Count()=%.0f want about %d", got, n)
+		}
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	profiles := newProfiles([]sql.RawBytes{[]byte("id"), []byte("name")})
+	profileFields(profiles, []sql.RawBytes{[]byte("1"), nil})
+	profileFields(profiles, []sql.RawBytes{[]byte("22"), []byte("abc")})
+	profileFields(profiles, []sql.RawBytes{[]byte("22"), []byte("")})
+
+	_, rows := profileTable(profiles)
+	want := [][]sql.RawBytes{
+		{[]byte("id"), []byte("3"), []byte("1"), []byte("2"), []byte("2")},
+		{[]byte("name"), []byte("2"), []byte("0"), []byte("3"), []byte("2")},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got=%q want=%q", rows, want)
+	}
+}
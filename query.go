@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// rowStatements are the statements that return rows and can be exported
+var rowStatements = []string{"select", "with", "show", "desc", "describe", "explain"}
+
+// validateQuery makes sure a query is a statement that returns rows
+func validateQuery(query string) error {
+	if strings.TrimSpace(query) == "" {
+		return errors.New("You must supply a query!")
+	}
+
+	verb := statementVerb(query)
+	for _, s := range rowStatements {
+		if verb == s {
+			// Common table expressions can also lead an update or delete
+			if verb == "with" && statementVerb(strings.TrimLeft(afterCTEs(query), "( \t\r\n")) != "select" {
+				return errors.New("A with statement must end in a select!")
+			}
+			return nil
+		}
+	}
+
+	return errors.New("Query must be a select, with, show, desc, describe or explain statement!")
+}
+
+// afterCTEs returns the statement following the common table expressions of a with query.
+// Parentheses in quoted strings and identifiers are skipped.
+func afterCTEs(query string) string {
+	query = strings.TrimSpace(query)
+	depth := 0
+	for i := len("with"); i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth != 0 {
+				continue
+			}
+
+			// A closing parenthesis ends a column list followed by AS or a CTE followed by
+			// a comma and the next, anything else is the statement
+			rest := strings.TrimSpace(query[i+1:])
+			switch {
+			case strings.HasPrefix(rest, ","):
+			case statementVerb(rest) == "as":
+			default:
+				return rest
+			}
+		}
+	}
+
+	return ""
+}
+
+// statementVerb returns the lower case keyword a query starts with, leading whitespace is ignored
+func statementVerb(query string) string {
+	query = strings.TrimSpace(query)
+	end := strings.IndexFunc(query, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z')
+	})
+	if end < 0 {
+		end = len(query)
+	}
+
+	return strings.ToLower(query[:end])
+}
+
+// derivedQuery reports if query can be wrapped as a derived table, SHOW, DESCRIBE and EXPLAIN
+// statements can not
+func derivedQuery(query string) bool {
+	verb := statementVerb(query)
+	return verb == "select" || verb == "with"
+}
+
+// runPrecheck runs a select and returns an error unless it returns a row whose first value is
+// true, values that are NULL, empty, 0 or false fail the check
+func runPrecheck(db *sql.DB, query string) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return errors.New("the precheck query returned no rows")
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	vals := make([]interface{}, len(cols))
+	var first sql.RawBytes
+	vals[0] = &first
+	for i := 1; i < len(vals); i++ {
+		vals[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(vals...); err != nil {
+		return err
+	}
+
+	if falsy(first) {
+		return fmt.Errorf("the precheck query returned %q", string(first))
+	}
+
+	return nil
+}
+
+// preflight runs the checks made before any output is created, the precheck query if one is
+// given and the exact row count for -count-header when count is set
+func preflight(db *sql.DB, query string, precheck string, count bool) (int64, error) {
+	if precheck != "" {
+		if err := runPrecheck(db, precheck); err != nil {
+			return 0, fmt.Errorf("Precheck failed: %s", err)
+		}
+	}
+
+	if !count {
+		return 0, nil
+	}
+	rows, _, err := countRows(db, query, true)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to count the query's rows: %s", err)
+	}
+
+	return rows, nil
+}
+
+// falsy reports if a value is NULL, empty, zero or false
+func falsy(value []byte) bool {
+	if value == nil {
+		return true
+	}
+
+	v := strings.ToLower(strings.TrimSpace(string(value)))
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return n == 0
+	}
+
+	return v == "" || v == "false"
+}
+
+// addExecutionTimeHint injects a MAX_EXECUTION_TIME optimizer hint after the leading SELECT
+// so the server aborts the query once ms milliseconds have elapsed
+func addExecutionTimeHint(query string, ms int) (string, error) {
+	query = strings.TrimSpace(query)
+	if len(query) < 6 || strings.ToLower(query[0:6]) != "select" {
+		return "", fmt.Errorf("-max-execution-time requires a plain select query")
+	}
+
+	return query[0:6] + " /*+ MAX_EXECUTION_TIME(" + strconv.Itoa(ms) + ") */" + query[6:], nil
+}
+
+// serverVersion returns the MySQL server version string
+func serverVersion(db *sql.DB) (string, error) {
+	var version string
+	err := db.QueryRow("SELECT VERSION()").Scan(&version)
+
+	return version, err
+}
+
+// queryCost runs EXPLAIN FORMAT=JSON for query and returns the optimizer's cost & estimated rows
+func queryCost(db *sql.DB, query string) (string, float64, error) {
+	var plan string
+	if err := db.QueryRow("EXPLAIN FORMAT=JSON " + query).Scan(&plan); err != nil {
+		return "", 0, err
+	}
+
+	return parseExplainCost([]byte(plan))
+}
+
+// parseExplainCost extracts the top level query_cost and the rows produced by the final
+// table of an EXPLAIN FORMAT=JSON plan
+func parseExplainCost(plan []byte) (string, float64, error) {
+	var doc struct {
+		QueryBlock map[string]interface{} `json:"query_block"`
+	}
+	if err := json.Unmarshal(plan, &doc); err != nil {
+		return "", 0, err
+	}
+
+	info, _ := doc.QueryBlock["cost_info"].(map[string]interface{})
+	cost, ok := info["query_cost"].(string)
+	if !ok {
+		return "", 0, errors.New("the server did not report a query cost")
+	}
+
+	return cost, explainRows(doc.QueryBlock), nil
+}
+
+// explainRows finds the rows produced by the last table joined in a plan block,
+// looking through sort, group & distinct operations that wrap the tables
+func explainRows(block map[string]interface{}) float64 {
+	if table, ok := block["table"].(map[string]interface{}); ok {
+		rows, _ := table["rows_produced_per_join"].(float64)
+		return rows
+	}
+
+	if loop, ok := block["nested_loop"].([]interface{}); ok && len(loop) > 0 {
+		if last, ok := loop[len(loop)-1].(map[string]interface{}); ok {
+			return explainRows(last)
+		}
+	}
+
+	for _, op := range []string{"ordering_operation", "grouping_operation", "duplicates_removal"} {
+		if inner, ok := block[op].(map[string]interface{}); ok {
+			return explainRows(inner)
+		}
+	}
+
+	return 0
+}
+
+// singleTableQuery matches select * from [db.]table with optional backtick quoting
+var singleTableQuery = regexp.MustCompile("(?is)^\\s*select\\s+\\*\\s+from\\s+(?:`([^`]+)`|(\\w+))(?:\\.(?:`([^`]+)`|(\\w+)))?\\s*;?\\s*$")
+
+// singleTable returns the schema & table read by a select * from [db.]table query.
+// The schema is blank when the table name is not qualified.
+func singleTable(query string) (string, string, bool) {
+	m := singleTableQuery.FindStringSubmatch(query)
+	if m == nil {
+		return "", "", false
+	}
+
+	first, second := m[1]+m[2], m[3]+m[4]
+	if second == "" {
+		return "", first, true
+	}
+
+	return first, second, true
+}
+
+// countRows returns the number of rows a query returns, reporting if the count is approximate.
+// Single table queries use the information_schema estimate unless exact is set, anything
+// else is counted by the server as a derived table.
+func countRows(db *sql.DB, query string, exact bool) (int64, bool, error) {
+	var count sql.NullInt64
+	schema, table, ok := singleTable(query)
+
+	if ok && !exact {
+		err := db.QueryRow("SELECT TABLE_ROWS FROM information_schema.tables WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?", schema, table).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, false, err
+		}
+
+		// Views have no estimate so they are counted
+		if count.Valid {
+			return count.Int64, true, nil
+		}
+	}
+
+	if ok {
+		name := quoteIdentifier(table)
+		if schema != "" {
+			name = quoteIdentifier(schema) + "." + name
+		}
+		err := db.QueryRow("SELECT COUNT(*) FROM " + name).Scan(&count)
+		return count.Int64, false, err
+	}
+
+	err := db.QueryRow("SELECT COUNT(*) FROM (" + strings.TrimRight(strings.TrimSpace(query), ";") + ") x").Scan(&count)
+	return count.Int64, false, err
+}
+
+// pageQuery wraps query as a derived table returning size rows ordered by key. Pages after
+// the first take the last key value of the previous page as their only argument.
+func pageQuery(query string, key string, size int, after bool) string {
+	key = quoteIdentifier(key)
+	page := "SELECT * FROM (" + strings.TrimRight(strings.TrimSpace(query), ";") + ") AS mycsv_page"
+	if after {
+		page += " WHERE " + key + " > ?"
+	}
+
+	return page + " ORDER BY " + key + " LIMIT " + strconv.Itoa(size)
+}
+
+// keyArg converts a page's last key value to a query argument. Numeric keys are passed as
+// numbers so the server does not compare them as strings.
+func keyArg(value []byte, numeric bool) interface{} {
+	if numeric {
+		if n, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(string(value), 64); err == nil {
+			return f
+		}
+	}
+
+	return string(value)
+}
+
+// lockError reports if err is a lock wait timeout or deadlock
+func lockError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	return mysqlErr.Number == 1205 || mysqlErr.Number == 1213
+}
+
+// queryWarning is a single row of SHOW WARNINGS output
+type queryWarning struct {
+	level   string
+	code    int
+	message string
+}
+
+// showWarnings returns the warnings raised by the last statement run on conn
+func showWarnings(conn *sql.Conn) ([]queryWarning, error) {
+	rows, err := conn.QueryContext(context.Background(), "SHOW WARNINGS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warnings []queryWarning
+	for rows.Next() {
+		var w queryWarning
+		if err := rows.Scan(&w.level, &w.code, &w.message); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, w)
+	}
+
+	return warnings, rows.Err()
+}
+
+// versionAtLeast reports if a MySQL version string such as 5.7.8-log is at least major.minor.patch.
+// MariaDB versions always report false as they do not share MySQL feature versions.
+func versionAtLeast(version string, major, minor, patch int) bool {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+
+	want := []int{major, minor, patch}
+	parts := strings.Split(version, ".")
+	for i, w := range want {
+		if i >= len(parts) {
+			return false
+		}
+
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return false
+		}
+		if n != w {
+			return n > w
+		}
+	}
+
+	return true
+}
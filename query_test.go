@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var validateQueryTests = []struct {
+	Query string
+	Valid bool
+}{
+	{Query: "select 1", Valid: true},
+	{Query: "  \n\tSELECT * from t", Valid: true},
+	{Query: "select*from t", Valid: true},
+	{Query: "WITH x AS (select 1) select * from x", Valid: true},
+	{Query: "with recursive x (n) as (select 1 union all select n + 1 from x where n < 3) select * from x", Valid: true},
+	{Query: "with a as (select ')' as p), b as (select `(`) select * from a, b", Valid: true},
+	{Query: "with x as (select 1) (select * from x)", Valid: true},
+	{Query: "WITH x AS (select 1) update t join x set t.a = 1", Valid: false},
+	{Query: "with x as (select 1) delete t from t join x", Valid: false},
+	{Query: "with x as (select 1) insert into t select * from x", Valid: false},
+	{Query: "with x as (select 1)", Valid: false},
+	{Query: "show tables", Valid: true},
+	{Query: "desc t", Valid: true},
+	{Query: "DESCRIBE t", Valid: true},
+	{Query: "explain select 1", Valid: true},
+	{Query: "delete from t", Valid: false},
+	{Query: "selection", Valid: false},
+	{Query: "use", Valid: false},
+	{Query: "sel", Valid: false},
+	{Query: "", Valid: false},
+	{Query: " \n", Valid: false},
+}
+
+func TestValidateQuery(t *testing.T) {
+	for n, tt := range validateQueryTests {
+		if err := validateQuery(tt.Query); (err == nil) != tt.Valid {
+			t.Errorf("#%d: %q got=%v want valid=%v", n, tt.Query, err, tt.Valid)
+		}
+	}
+
+	if err := validateQuery(" "); err == nil || !strings.HasPrefix(err.Error(), "You must supply a query") {
+		t.Errorf("empty query got=%v", err)
+	}
+
+	// The precheck is held to the same rules before it is run
+	if err := runPrecheck(nil, "with x as (select 1) delete from t"); err == nil {
+		t.Error("precheck with delete got=nil want an error")
+	}
+
+	if !derivedQuery("with x as (select 1) select * from x") || derivedQuery("show tables") {
+		t.Error("only select and with queries can be derived tables")
+	}
+}
+
+func TestAddExecutionTimeHint(t *testing.T) {
+	got, err := addExecutionTimeHint("  SELECT * from t", 500)
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if want := "SELECT /*+ MAX_EXECUTION_TIME(500) */ * from t"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+
+	_, err = addExecutionTimeHint("show tables", 500)
+	if err == nil {
+		t.Error("Error should not be nil")
+	}
+}
+
+var versionTests = []struct {
+	Version string
+	Output  bool
+}{
+	{Version: "5.7.8", Output: true},
+	{Version: "5.7.8-log", Output: true},
+	{Version: "5.7.7", Output: false},
+	{Version: "5.6.40", Output: false},
+	{Version: "8.0.30", Output: true},
+	{Version: "10.6.12-MariaDB", Output: false},
+	{Version: "junk", Output: false},
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for n, tt := range versionTests {
+		if got := versionAtLeast(tt.Version, 5, 7, 8); got != tt.Output {
+			t.Errorf("#%d: %s got=%v want=%v", n, tt.Version, got, tt.Output)
+		}
+	}
+}
+
+var explainTests = []struct {
+	Plan string
+	Cost string
+	Rows float64
+	Err  bool
+}{
+	{Plan: `{"query_block": {"select_id": 1, "cost_info": {"query_cost": "1.20"}, "table": {"table_name": "t", "rows_produced_per_join": 10}}}`, Cost: "1.20", Rows: 10},
+	{Plan: `{"query_block": {"cost_info": {"query_cost": "35.50"}, "nested_loop": [{"table": {"rows_produced_per_join": 10}}, {"table": {"rows_produced_per_join": 100}}]}}`, Cost: "35.50", Rows: 100},
+	{Plan: `{"query_block": {"cost_info": {"query_cost": "8.00"}, "ordering_operation": {"using_filesort": true, "table": {"rows_produced_per_join": 7}}}}`, Cost: "8.00", Rows: 7},
+	{Plan: `{"query_block": {"select_id": 1, "table": {"rows": 10}}}`, Err: true},
+	{Plan: `not json`, Err: true},
+}
+
+func TestParseExplainCost(t *testing.T) {
+	for n, tt := range explainTests {
+		cost, rows, err := parseExplainCost([]byte(tt.Plan))
+		if tt.Err {
+			if err == nil {
+				t.Errorf("#%d: Error should not be nil", n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+		if cost != tt.Cost || rows != tt.Rows {
+			t.Errorf("#%d: got=%s, %v want=%s, %v", n, cost, rows, tt.Cost, tt.Rows)
+		}
+	}
+}
+
+var singleTableTests = []struct {
+	Query  string
+	Schema string
+	Table  string
+	OK     bool
+}{
+	{Query: "select * from t", Table: "t", OK: true},
+	{Query: "  SELECT *\nFROM db.t;", Schema: "db", Table: "t", OK: true},
+	{Query: "select * from `my db`.`my-table`", Schema: "my db", Table: "my-table", OK: true},
+	{Query: "select * from t where id > 5", OK: false},
+	{Query: "select a from t", OK: false},
+	{Query: "select * from t1 join t2", OK: false},
+}
+
+func TestSingleTable(t *testing.T) {
+	for n, tt := range singleTableTests {
+		schema, table, ok := singleTable(tt.Query)
+		if schema != tt.Schema || table != tt.Table || ok != tt.OK {
+			t.Errorf("#%d: got=%q, %q, %v want=%q, %q, %v", n, schema, table, ok, tt.Schema, tt.Table, tt.OK)
+		}
+	}
+}
+
+func TestFalsy(t *testing.T) {
+	for _, v := range []string{"", "0", "0.00", "false", "FALSE", " 0 "} {
+		if !falsy([]byte(v)) {
+			t.Errorf("%q should be falsy", v)
+		}
+	}
+	for _, v := range []string{"1", "-1", "0.5", "true", "yes", "2017-01-01"} {
+		if falsy([]byte(v)) {
+			t.Errorf("%q should not be falsy", v)
+		}
+	}
+	if !falsy(nil) {
+		t.Error("NULL should be falsy")
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	got := pageQuery("select * from t;", "id", 500, false)
+	want := "SELECT * FROM (select * from t) AS mycsv_page ORDER BY `id` LIMIT 500"
+	if got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+
+	got = pageQuery("select * from t", "id", 500, true)
+	want = "SELECT * FROM (select * from t) AS mycsv_page WHERE `id` > ? ORDER BY `id` LIMIT 500"
+	if got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestKeyArg(t *testing.T) {
+	tests := []struct {
+		value   string
+		numeric bool
+		want    interface{}
+	}{
+		{"10", true, int64(10)},
+		{"18446744073709551615", true, uint64(18446744073709551615)},
+		{"1.5", true, 1.5},
+		{"10", false, "10"},
+	}
+	for _, tt := range tests {
+		if got := keyArg([]byte(tt.value), tt.numeric); got != tt.want {
+			t.Errorf("keyArg(%q, %v)=%#v want %#v", tt.value, tt.numeric, got, tt.want)
+		}
+	}
+}
+
+func TestLockError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{fmt.Errorf("page failed: %w", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}), true},
+		{&mysql.MySQLError{Number: 1064, Message: "syntax error"}, false},
+		{errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := lockError(tt.err); got != tt.want {
+			t.Errorf("lockError(%v)=%v want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+)
+
+// A RawWriter writes the bytes of each field verbatim followed by a terminator, with no
+// quoting or escaping. It is intended for single column queries such as blob extraction,
+// multiple fields are written back to back and NULL fields are written as nothing.
+type RawWriter struct {
+	Terminator string // Written after each record (set to "\n" by NewRawWriter)
+	w          *bufio.Writer
+}
+
+// NewRawWriter returns a new RawWriter that writes to w.
+func NewRawWriter(w io.Writer) *RawWriter {
+	return NewRawWriterSize(w, 4096)
+}
+
+// NewRawWriterSize returns a new RawWriter that writes to w and buffers at least size bytes
+// between writes to the underlying io.Writer.
+func NewRawWriterSize(w io.Writer, size int) *RawWriter {
+	return &RawWriter{Terminator: "\n", w: bufio.NewWriterSize(w, size)}
+}
+
+// WriteHeader writes the column names the same as a record.
+func (w *RawWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	return w.Write(cols)
+}
+
+// Write writes the record's fields followed by the terminator.
+func (w *RawWriter) Write(record []sql.RawBytes) (buf int, err error) {
+	for _, field := range record {
+		if _, err = w.w.Write(field); err != nil {
+			return
+		}
+	}
+	if _, err = w.w.WriteString(w.Terminator); err != nil {
+		return
+	}
+
+	// Return the number of bytes written to the current buffer
+	buf = w.w.Buffered()
+
+	return buf, err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *RawWriter) Flush() {
+	w.w.Flush()
+}
+
+// Close flushes the remaining output. The underlying io.Writer is not closed.
+func (w *RawWriter) Close() error {
+	return w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *RawWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+var rawTests = []struct {
+	Input      [][]sql.RawBytes
+	Terminator string
+	Output     string
+}{
+	{Input: [][]sql.RawBytes{{[]byte("abc")}}, Terminator: "\n", Output: "abc\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a,\"b\\\n\x00")}}, Terminator: "\n", Output: "a,\"b\\\n\x00\n"},
+	{Input: [][]sql.RawBytes{{nil}, {[]byte("")}}, Terminator: "\r\n", Output: "\r\n\r\n"},
+	{Input: [][]sql.RawBytes{{[]byte("\x89PNG")}, {[]byte("GIF8")}}, Terminator: "", Output: "\x89PNGGIF8"},
+}
+
+func TestRawWrite(t *testing.T) {
+	for n, tt := range rawTests {
+		b := &bytes.Buffer{}
+		f := NewRawWriter(b)
+		f.Terminator = tt.Terminator
+		for _, record := range tt.Input {
+			_, err := f.Write(record)
+			if err != nil {
+				t.Errorf("Unexpected error: %s\n", err)
+			}
+		}
+		err := f.Close()
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+
+		if out := b.String(); out != tt.Output {
+			t.Errorf("#%d: out=%q want %q", n, out, tt.Output)
+		}
+	}
+}
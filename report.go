@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A runReport collects run metadata for the -report JSON file and the -syslog audit messages.
+// It is written once, either when the export completes or as a partial report when mycsv
+// exits early on an error or interrupt. All methods are safe to call on a nil *runReport so
+// callers need no checks.
+type runReport struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	start  time.Time
+	query  string
+	rows   uint64
+	files  []*outputFile
+	stdout *countingOutput
+	done   bool
+
+	// Audit messages are sent when -syslog is enabled
+	audit     auditLog
+	auditUser string
+	auditHost string
+	auditDest string
+}
+
+// Reporting is disabled unless main() creates a report
+var report *runReport
+
+// newRunReport returns a runReport that will be written to w, a nil w only sends audit messages
+func newRunReport(w io.WriteCloser, start time.Time) *runReport {
+	return &runReport{w: w, start: start}
+}
+
+// setQuery records the query text, the report holds only its hash
+func (r *runReport) setQuery(query string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.query = query
+	r.mu.Unlock()
+}
+
+// setAudit sends the export's start & completion messages to a, identifying the database
+// user and host
+func (r *runReport) setAudit(a auditLog, user string, host string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.audit, r.auditUser, r.auditHost = a, user, host
+	r.mu.Unlock()
+}
+
+// auditStart sends the audit message for an export writing to dest
+func (r *runReport) auditStart(dest string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auditDest = dest
+	if r.audit == nil {
+		return
+	}
+
+	err := r.audit.Info(auditMessage("export started", "user", r.auditUser, "host", r.auditHost, "query_sha256", queryHash(r.query), "destination", dest))
+	if err != nil {
+		logger.Printf("Warning: unable to send the audit message to syslog: %s\n", err)
+	}
+}
+
+// addFile records an output file
+func (r *runReport) addFile(f *outputFile) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.files = append(r.files, f)
+	r.mu.Unlock()
+}
+
+// removeFile drops an output file that was deleted after it was written
+func (r *runReport) removeFile(f *outputFile) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	for i := range r.files {
+		if r.files[i] == f {
+			r.files = append(r.files[:i], r.files[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+}
+
+// addRow counts a row written
+func (r *runReport) addRow() {
+	if r == nil {
+		return
+	}
+	atomic.AddUint64(&r.rows, 1)
+}
+
+// finish writes the report with the run's final status, only the first call writes anything
+func (r *runReport) finish(status string, code int, failure error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+
+	end := time.Now()
+	var bytes int64
+	files := make([]string, len(r.files))
+	for i, f := range r.files {
+		files[i] = f.name
+		bytes += f.bytes.n
+	}
+	if r.stdout != nil {
+		bytes += r.stdout.n
+	}
+
+	fields := map[string]interface{}{
+		"start":            r.start.Format(time.RFC3339Nano),
+		"end":              end.Format(time.RFC3339Nano),
+		"duration_seconds": end.Sub(r.start).Seconds(),
+		"rows":             atomic.LoadUint64(&r.rows),
+		"bytes":            bytes,
+		"files":            files,
+		"status":           status,
+		"exit_code":        code,
+	}
+	if r.query != "" {
+		fields["query_sha256"] = queryHash(r.query)
+	}
+	if failure != nil {
+		fields["error"] = failure.Error()
+	}
+
+	if r.audit != nil {
+		r.auditFinish(fields)
+	}
+	if r.w == nil {
+		return
+	}
+
+	b, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return
+	}
+	r.w.Write(append(b, '\n'))
+	r.w.Close()
+}
+
+// auditFinish sends the audit message for the end of an export, failures are logged as errors
+func (r *runReport) auditFinish(fields map[string]interface{}) {
+	pairs := []interface{}{"user", r.auditUser, "host", r.auditHost, "query_sha256", queryHash(r.query), "destination", r.auditDest}
+	for _, key := range []string{"status", "exit_code", "rows", "bytes", "duration_seconds", "error"} {
+		if v, ok := fields[key]; ok {
+			pairs = append(pairs, key, v)
+		}
+	}
+
+	send := r.audit.Info
+	if fields["exit_code"] != 0 {
+		send = r.audit.Err
+	}
+	if err := send(auditMessage("export finished", pairs...)); err != nil {
+		logger.Printf("Warning: unable to send the audit message to syslog: %s\n", err)
+	}
+	r.audit.Close()
+}
+
+// queryHash returns the hex encoded SHA-256 of a query, "" when there is no single query
+func queryHash(query string) string {
+	if query == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(query))
+
+	return hex.EncodeToString(sum[:])
+}
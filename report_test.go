@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	out := &closeBuffer{}
+	r := newRunReport(out, time.Now())
+	r.setQuery("select 1")
+	r.addFile(&outputFile{name: "a.csv", bytes: &countingOutput{n: 10}})
+	r.addRow()
+	r.addRow()
+	r.finish("failed", 74, errors.New("disk full"))
+	r.finish("complete", 0, nil)
+
+	if !out.closed {
+		t.Error("report was not closed")
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if got["status"] != "failed" || got["exit_code"] != float64(74) || got["error"] != "disk full" {
+		t.Errorf("only the first finish should be reported, got=%v", got)
+	}
+	if got["rows"] != float64(2) || got["bytes"] != float64(10) {
+		t.Errorf("got rows=%v bytes=%v want rows=2 bytes=10", got["rows"], got["bytes"])
+	}
+
+	// Reporting is optional so a nil report must be safe to use
+	var none *runReport
+	none.addRow()
+	none.finish("complete", 0, nil)
+}
+
+// auditBuffer records the messages sent to it by severity
+type auditBuffer struct {
+	info, err []string
+	closed    bool
+}
+
+func (a *auditBuffer) Info(m string) error { a.info = append(a.info, m); return nil }
+func (a *auditBuffer) Err(m string) error  { a.err = append(a.err, m); return nil }
+func (a *auditBuffer) Close() error        { a.closed = true; return nil }
+
+func TestRunReportAudit(t *testing.T) {
+	a := &auditBuffer{}
+	r := newRunReport(nil, time.Now())
+	r.setQuery("select 1")
+	r.setAudit(a, "jprunier", "db1:3306")
+	r.auditStart("out.csv")
+	r.addRow()
+	r.finish("failed", 74, errors.New("disk full"))
+
+	want := `mycsv export started user="jprunier" host="db1:3306" query_sha256="822ae07d4783158bc1912bb623e5107cc9002d519e1143a9c200ed6ee18b6d0f" destination="out.csv"`
+	if len(a.info) != 1 || a.info[0] != want {
+		t.Errorf("got=%q want=%q", a.info, want)
+	}
+	if len(a.err) != 1 || !strings.HasPrefix(a.err[0], `mycsv export finished user="jprunier"`) ||
+		!strings.Contains(a.err[0], ` status="failed" exit_code=74 rows=1 bytes=0 `) || !strings.HasSuffix(a.err[0], ` error="disk full"`) {
+		t.Errorf("got=%q", a.err)
+	}
+	if !a.closed {
+		t.Error("audit log was not closed")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A rotatingOutput writes to a series of output files, moving to a new file each time rotate
+// is called. Each file name is the output name with the time the file covers inserted before
+// its extension, out.csv becomes out.20170101-150405.csv. Files split by row count or size
+// are numbered instead, out.000.csv, out.001.csv and so on.
+type rotatingOutput struct {
+	name     string
+	compress string
+	interval time.Duration
+	rows     uint
+	bytes    int64
+	written  int64
+	pending  int
+	current  io.WriteCloser
+	started  time.Time
+	files    []*outputFile
+}
+
+// newRotatingOutput opens the first output file derived from name
+func newRotatingOutput(name string, compress string, interval time.Duration) (*rotatingOutput, error) {
+	r := &rotatingOutput{name: name, compress: compress, interval: interval}
+
+	return r, r.open()
+}
+
+// newSplitOutput opens the first of a series of numbered output files, each holding rows rows
+// or ending with the row that brings it to bytes bytes before compression
+func newSplitOutput(name string, compress string, rows uint, bytes int64) (*rotatingOutput, error) {
+	r := &rotatingOutput{name: name, compress: compress, rows: rows, bytes: bytes}
+
+	return r, r.open()
+}
+
+// Write writes p to the current output file, anything the writer had buffered is now written
+func (r *rotatingOutput) Write(p []byte) (int, error) {
+	n, err := r.current.Write(p)
+	r.written += int64(n)
+	r.pending = 0
+
+	return n, err
+}
+
+// Close finalizes the current output file
+func (r *rotatingOutput) Close() error {
+	return r.current.Close()
+}
+
+// count adds a row written to the current output file, buffered is the number of bytes the
+// writer is holding that have not reached Write yet
+func (r *rotatingOutput) count(buffered int) {
+	r.files[len(r.files)-1].rows++
+	r.pending = buffered
+}
+
+// due reports if the current output file has reached the end of its interval, row count or size
+func (r *rotatingOutput) due() bool {
+	if r.rows > 0 {
+		return r.files[len(r.files)-1].rows >= r.rows
+	}
+	if r.bytes > 0 {
+		return r.written+int64(r.pending) >= r.bytes
+	}
+
+	return r.interval > 0 && !time.Now().Before(r.started.Add(r.interval))
+}
+
+// split reports if files are numbered rather than timestamped
+func (r *rotatingOutput) split() bool {
+	return r.rows > 0 || r.bytes > 0
+}
+
+// rotate finalizes the current output file and opens the next one
+func (r *rotatingOutput) rotate() error {
+	if err := r.current.Close(); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// open creates the next output file, intervals are aligned to clock boundaries
+func (r *rotatingOutput) open() error {
+	r.started = time.Now()
+	if r.interval > 0 {
+		r.started = r.started.Truncate(r.interval)
+	}
+
+	tag := r.started.Format("20060102-150405")
+	if r.split() {
+		tag = fmt.Sprintf("%03d", len(r.files))
+	}
+
+	name := rotatedName(r.name, tag)
+	output, file, err := openOutput(name, r.compress)
+	if err != nil {
+		return err
+	}
+
+	r.current = output
+	r.files = append(r.files, file)
+	r.written, r.pending = 0, 0
+
+	return nil
+}
+
+// rotatedName inserts tag into name before the extension, everything after the first dot
+// of the file name is treated as the extension so out.csv.gz becomes out.<tag>.csv.gz
+func rotatedName(name string, tag string) string {
+	dir, file := filepath.Split(name)
+	if i := strings.Index(file, "."); i > 0 {
+		return dir + file[:i] + "." + tag + file[i:]
+	}
+
+	return name + "." + tag
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var rotatedNameTests = []struct {
+	Name   string
+	Output string
+}{
+	{Name: "out.csv", Output: "out.TAG.csv"},
+	{Name: "out.csv.gz", Output: "out.TAG.csv.gz"},
+	{Name: "out", Output: "out.TAG"},
+	{Name: "/tmp/x.y/out.csv", Output: "/tmp/x.y/out.TAG.csv"},
+	{Name: ".hidden", Output: ".hidden.TAG"},
+	{Name: "gs://bucket/dir/out.csv", Output: "gs://bucket/dir/out.TAG.csv"},
+}
+
+func TestRotatedName(t *testing.T) {
+	for n, tt := range rotatedNameTests {
+		if got := rotatedName(tt.Name, "TAG"); got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mycsv-split-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newSplitOutput(filepath.Join(dir, "out.csv"), "none", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if r.due() {
+			if err := r.rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fmt.Fprintln(r, i)
+		r.count(0)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"out.000.csv": "0\n1\n", "out.001.csv": "2\n3\n", "out.002.csv": "4\n"}
+	if len(r.files) != len(want) {
+		t.Errorf("got %d files want %d", len(r.files), len(want))
+	}
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		} else if string(got) != content {
+			t.Errorf("%s: got=%q want=%q", name, got, content)
+		}
+	}
+}
+
+func TestSplitOutputBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mycsv-split-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newSplitOutput(filepath.Join(dir, "out.csv"), "none", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bytes still buffered by the writer count towards the size
+	r.count(4)
+	if r.due() {
+		t.Error("due before the size is reached")
+	}
+	r.count(6)
+	if !r.due() {
+		t.Error("not due once buffered bytes reach the size")
+	}
+	fmt.Fprint(r, "abcdef")
+	if !r.due() {
+		t.Error("not due once written bytes reach the size")
+	}
+
+	if err := r.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.due() || len(r.files) != 2 || filepath.Base(r.files[1].name) != "out.001.csv" {
+		t.Errorf("got due=%v files=%d after rotating", r.due(), len(r.files))
+	}
+	r.Close()
+}
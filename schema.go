@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// schemaColumn describes a single column in the -schema-file JSON document. Properties
+// the driver can not report are omitted.
+type schemaColumn struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  *bool  `json:"nullable,omitempty"`
+	Length    *int64 `json:"length,omitempty"`
+	Precision *int64 `json:"precision,omitempty"`
+	Scale     *int64 `json:"scale,omitempty"`
+}
+
+// writeSchema writes the query's column metadata to w as a JSON document
+func writeSchema(w io.Writer, cols []column) error {
+	columns := make([]schemaColumn, len(cols))
+	for i, c := range cols {
+		col := schemaColumn{Name: c.name, Type: c.dbType}
+		ct := c.info
+		if ct == nil {
+			columns[i] = col
+			continue
+		}
+		if nullable, ok := ct.Nullable(); ok {
+			col.Nullable = &nullable
+		}
+		if length, ok := ct.Length(); ok {
+			col.Length = &length
+		}
+		if precision, scale, ok := ct.DecimalSize(); ok {
+			col.Precision = &precision
+			col.Scale = &scale
+		}
+		columns[i] = col
+	}
+
+	b, err := json.MarshalIndent(map[string]interface{}{"columns": columns}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
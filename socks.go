@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/net/proxy"
+)
+
+// socksNetwork is the DSN network name connections through -socks5 are registered under
+const socksNetwork = "socks5"
+
+// registerSOCKS5 routes connections using the socks5 DSN network through the proxy at addr
+func registerSOCKS5(addr string, user string, pass string) error {
+	dial, err := socksDial(addr, user, pass)
+	if err != nil {
+		return err
+	}
+
+	mysql.RegisterDialContext(socksNetwork, dial)
+	return nil
+}
+
+// socksDial returns a function that opens TCP connections through the SOCKS5 proxy at addr,
+// authenticating with user & pass if a user is given
+func socksDial(addr string, user string, pass string) (mysql.DialContextFunc, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("SOCKS5 proxy must be host:port: %s", err)
+	}
+
+	var auth *proxy.Auth
+	if user != "" {
+		auth = &proxy.Auth{User: user, Password: pass}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", addr, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+
+	// The SOCKS5 dialer honours the context so connect timeouts apply to the proxy handshake
+	cd := dialer.(proxy.ContextDialer)
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return cd.DialContext(ctx, "tcp", addr)
+	}, nil
+}
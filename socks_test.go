@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// serveSOCKS5 accepts a single connection on l, checks the username & password and relays
+// the CONNECT request to its target
+func serveSOCKS5(t *testing.T, l net.Listener, user string, pass string) {
+	c, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	// Greeting, only username & password authentication is offered
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(c, buf[:2]); err != nil {
+		t.Error(err)
+		return
+	}
+	io.ReadFull(c, buf[:buf[1]])
+	c.Write([]byte{5, 2})
+
+	// RFC 1929 username & password
+	io.ReadFull(c, buf[:2])
+	u := make([]byte, buf[1])
+	io.ReadFull(c, u)
+	io.ReadFull(c, buf[:1])
+	p := make([]byte, buf[0])
+	io.ReadFull(c, p)
+	if string(u) != user || string(p) != pass {
+		c.Write([]byte{1, 1})
+		return
+	}
+	c.Write([]byte{1, 0})
+
+	// CONNECT request with a domain name or IPv4 address
+	io.ReadFull(c, buf[:4])
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(c, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(c, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(c, name)
+		host = string(name)
+	}
+	io.ReadFull(c, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, c)
+	io.Copy(c, target)
+}
+
+func TestSOCKSDial(t *testing.T) {
+	// The target writes a greeting like a MySQL server would
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		c, err := target.Accept()
+		if err == nil {
+			c.Write([]byte("hello"))
+			c.Close()
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveSOCKS5(t, l, "proxyuser", "secret")
+
+	dial, err := socksDial(l.Addr().String(), "proxyuser", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	c, err := dial(context.Background(), target.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	defer c.Close()
+
+	got, _ := io.ReadAll(c)
+	if !bytes.Equal(got, []byte("hello")) {
+		t.Errorf("got=%q want=%q", got, "hello")
+	}
+}
+
+func TestSOCKSDialAddress(t *testing.T) {
+	if _, err := socksDial("localhost", "", ""); err == nil {
+		t.Error("Expected an error for a proxy address without a port")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// A sortingWriter buffers every record written to it and writes them to the underlying
+// recordWriter sorted by a single column when closed. The header is passed straight through.
+type sortingWriter struct {
+	recordWriter
+	col     int
+	numeric bool
+	desc    bool
+	max     int
+	key     sql.RawBytes
+	keyed   bool
+	rows    []sortedRecord
+}
+
+// A sortedRecord is a buffered record and the value it is sorted by
+type sortedRecord struct {
+	key    sql.RawBytes
+	record []sql.RawBytes
+}
+
+// newSortingWriter returns a sortingWriter that sorts by field col of each record, holding
+// at most max records. Numeric columns are compared by value instead of byte by byte.
+func newSortingWriter(w recordWriter, col int, numeric bool, desc bool, max int) *sortingWriter {
+	return &sortingWriter{recordWriter: w, col: col, numeric: numeric, desc: desc, max: max}
+}
+
+// setKey copies the value the next record written is sorted by instead of its col field, so
+// records can be sorted by the value read before it was formatted
+func (s *sortingWriter) setKey(key []byte) {
+	s.key = nil
+	if key != nil {
+		s.key = append(sql.RawBytes{}, key...)
+	}
+	s.keyed = true
+}
+
+// Write copies record into the buffer, nothing is written until Close
+func (s *sortingWriter) Write(record []sql.RawBytes) (int, error) {
+	if len(s.rows) >= s.max {
+		return 0, fmt.Errorf("sorted output exceeds %d rows, raise -sort-max-rows or sort in the query", s.max)
+	}
+
+	r := sortedRecord{record: copyRecord(record)}
+	r.key = r.record[s.col]
+	if s.keyed {
+		r.key = s.key
+		s.keyed = false
+	}
+	s.rows = append(s.rows, r)
+	return 0, nil
+}
+
+// Close sorts the buffered records, writes them and closes the underlying recordWriter
+func (s *sortingWriter) Close() error {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		c := compareFields(s.rows[i].key, s.rows[j].key, s.numeric)
+		if s.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	for _, r := range s.rows {
+		if _, err := s.recordWriter.Write(r.record); err != nil {
+			return err
+		}
+	}
+	s.rows = nil
+
+	return s.recordWriter.Close()
+}
+
+// A reversingWriter buffers every record written to it and writes them to the underlying
+// recordWriter last first when closed. The header is passed straight through.
+type reversingWriter struct {
+	recordWriter
+	max  int
+	rows [][]sql.RawBytes
+}
+
+// newReversingWriter returns a reversingWriter holding at most max records
+func newReversingWriter(w recordWriter, max int) *reversingWriter {
+	return &reversingWriter{recordWriter: w, max: max}
+}
+
+// Write copies record into the buffer, nothing is written until Close
+func (r *reversingWriter) Write(record []sql.RawBytes) (int, error) {
+	if len(r.rows) >= r.max {
+		return 0, fmt.Errorf("reversed output exceeds %d rows, raise -reverse-max-rows or order the query", r.max)
+	}
+
+	r.rows = append(r.rows, copyRecord(record))
+	return 0, nil
+}
+
+// Close writes the buffered records in reverse order and closes the underlying recordWriter
+func (r *reversingWriter) Close() error {
+	for i := len(r.rows) - 1; i >= 0; i-- {
+		if _, err := r.recordWriter.Write(r.rows[i]); err != nil {
+			return err
+		}
+	}
+	r.rows = nil
+
+	return r.recordWriter.Close()
+}
+
+// copyRecord returns a copy of record that does not share memory with the scan buffers
+func copyRecord(record []sql.RawBytes) []sql.RawBytes {
+	out := make([]sql.RawBytes, len(record))
+	for i, field := range record {
+		if field != nil {
+			out[i] = append(make([]byte, 0, len(field)), field...)
+		}
+	}
+
+	return out
+}
+
+// compareFields compares two field values, NULL sorts before every value as it does in MySQL.
+// Numeric values that can not be parsed fall back to comparing bytes.
+func compareFields(a []byte, b []byte, numeric bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if numeric {
+		if x, err := strconv.ParseInt(string(a), 10, 64); err == nil {
+			if y, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+				switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+				}
+				return 0
+			}
+		}
+		if x, err := strconv.ParseFloat(string(a), 64); err == nil {
+			if y, err := strconv.ParseFloat(string(b), 64); err == nil {
+				switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+				}
+				return 0
+			}
+		}
+	}
+
+	return bytes.Compare(a, b)
+}
+
+// numericTypes are the column types sorted by value
+var numericTypes = []string{
+	"TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR",
+	"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT",
+}
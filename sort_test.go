@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestSortingWriter(t *testing.T) {
+	tests := []struct {
+		numeric bool
+		desc    bool
+		want    string
+	}{
+		{numeric: true, want: "n\n\\N\n2\n10\n"},
+		{numeric: false, want: "n\n\\N\n10\n2\n"},
+		{numeric: true, desc: true, want: "n\n10\n2\n\\N\n"},
+	}
+
+	for n, tt := range tests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Quote = ""
+		s := newSortingWriter(f, 0, tt.numeric, tt.desc, 10)
+		s.WriteHeader([]sql.RawBytes{[]byte("n")})
+
+		// The scan buffer is reused between rows so the writer must copy it
+		field := []byte("10")
+		s.Write([]sql.RawBytes{field})
+		copy(field, "2")
+		s.Write([]sql.RawBytes{field[:1]})
+		s.Write([]sql.RawBytes{nil})
+		if err := s.Close(); err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.want)
+		}
+	}
+}
+
+func TestSortingWriterMax(t *testing.T) {
+	s := newSortingWriter(NewWriter(&bytes.Buffer{}), 0, false, false, 1)
+	if _, err := s.Write([]sql.RawBytes{[]byte("a")}); err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if _, err := s.Write([]sql.RawBytes{[]byte("b")}); err == nil {
+		t.Error("Expected an error past the row limit")
+	}
+}
+
+func TestReversingWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewWriter(b)
+	f.Quote = ""
+	r := newReversingWriter(f, 3)
+	r.WriteHeader([]sql.RawBytes{[]byte("n")})
+
+	field := []byte("1")
+	for _, v := range []string{"1", "2", "3"} {
+		copy(field, v)
+		r.Write([]sql.RawBytes{field})
+	}
+	if _, err := r.Write([]sql.RawBytes{field}); err == nil {
+		t.Error("Expected an error past the row limit")
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	if got, want := b.String(), "n\n3\n2\n1\n"; got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
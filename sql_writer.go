@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"strings"
+)
+
+// A SQLWriter writes records as MySQL INSERT statements.
+//
+// Column names passed to WriteHeader are used as the INSERT column list, if WriteHeader
+// is never called the column list is omitted. Every field is written as a quoted string
+// literal and nil fields are written as NULL. Batch rows are grouped into each INSERT.
+type SQLWriter struct {
+	Table string // Target table name, may be qualified as db.table
+	Batch int    // Number of rows per INSERT statement (set to 1 by NewSQLWriter)
+	cols  string
+	rows  int
+	w     *bufio.Writer
+}
+
+// NewSQLWriter returns a new SQLWriter that writes to w.
+func NewSQLWriter(w io.Writer) *SQLWriter {
+	return NewSQLWriterSize(w, 4096)
+}
+
+// NewSQLWriterSize returns a new SQLWriter that writes to w and buffers at least size bytes
+// between writes to the underlying io.Writer.
+func NewSQLWriterSize(w io.Writer, size int) *SQLWriter {
+	return &SQLWriter{
+		Batch: 1,
+		w:     bufio.NewWriterSize(w, size),
+	}
+}
+
+// WriteHeader sets the column list used by each INSERT statement.
+func (w *SQLWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = quoteIdentifier(string(col))
+	}
+	w.cols = " (" + strings.Join(names, ", ") + ")"
+
+	return w.w.Buffered(), nil
+}
+
+// Write writes a single record as a row of an INSERT statement.
+func (w *SQLWriter) Write(record []sql.RawBytes) (buf int, err error) {
+	// Start a new statement or continue the current one
+	if w.rows == 0 {
+		_, err = w.w.WriteString("INSERT INTO " + w.table() + w.cols + " VALUES\n(")
+	} else {
+		_, err = w.w.WriteString(",\n(")
+	}
+	if err != nil {
+		return
+	}
+
+	for n, field := range record {
+		if n > 0 {
+			if _, err = w.w.WriteString(", "); err != nil {
+				return
+			}
+		}
+
+		if field == nil {
+			_, err = w.w.WriteString("NULL")
+		} else {
+			err = writeStringLiteral(w.w, field)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if _, err = w.w.WriteString(")"); err != nil {
+		return
+	}
+
+	// End the statement once the batch is full
+	w.rows++
+	if w.rows >= w.Batch {
+		err = w.end()
+	}
+
+	// Return the number of bytes written to the current buffer
+	buf = w.w.Buffered()
+
+	return buf, err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *SQLWriter) Flush() {
+	w.w.Flush()
+}
+
+// Close ends any open INSERT statement and flushes the remaining output.
+func (w *SQLWriter) Close() error {
+	if err := w.end(); err != nil {
+		return err
+	}
+
+	return w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *SQLWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// end terminates the current INSERT statement if one is open
+func (w *SQLWriter) end() error {
+	if w.rows == 0 {
+		return nil
+	}
+	w.rows = 0
+
+	_, err := w.w.WriteString(";\n")
+	return err
+}
+
+// table returns the quoted target table name
+func (w *SQLWriter) table() string {
+	parts := strings.Split(w.Table, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// quoteIdentifier backtick quotes a MySQL identifier
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// writeStringLiteral writes field as a single quoted MySQL string literal
+func writeStringLiteral(w *bufio.Writer, field []byte) (err error) {
+	if err = w.WriteByte('\''); err != nil {
+		return
+	}
+
+	for _, f := range field {
+		switch f {
+		case 0x00:
+			_, err = w.WriteString(`\0`)
+		case '\'':
+			_, err = w.WriteString(`\'`)
+		case '"':
+			_, err = w.WriteString(`\"`)
+		case '\b':
+			_, err = w.WriteString(`\b`)
+		case '\n':
+			_, err = w.WriteString(`\n`)
+		case '\r':
+			_, err = w.WriteString(`\r`)
+		case '\t':
+			_, err = w.WriteString(`\t`)
+		case 0x1A:
+			_, err = w.WriteString(`\Z`)
+		case '\\':
+			_, err = w.WriteString(`\\`)
+		default:
+			err = w.WriteByte(f)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return w.WriteByte('\'')
+}
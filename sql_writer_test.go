@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+var sqlWriteTests = []struct {
+	Header []sql.RawBytes
+	Input  [][]sql.RawBytes
+	Batch  int
+	Output string
+}{
+	{Input: [][]sql.RawBytes{{[]byte("abc")}}, Batch: 1, Output: "INSERT INTO `t` VALUES\n('abc');\n"},
+	{Header: []sql.RawBytes{[]byte("a"), []byte("b")}, Input: [][]sql.RawBytes{{[]byte("1"), []byte("2")}}, Batch: 1, Output: "INSERT INTO `t` (`a`, `b`) VALUES\n('1', '2');\n"},
+	{Header: []sql.RawBytes{[]byte("a`b")}, Input: [][]sql.RawBytes{{[]byte("1")}}, Batch: 1, Output: "INSERT INTO `t` (`a``b`) VALUES\n('1');\n"},
+	{Input: [][]sql.RawBytes{{nil, []byte("")}}, Batch: 1, Output: "INSERT INTO `t` VALUES\n(NULL, '');\n"},
+	{Input: [][]sql.RawBytes{{[]byte("it's")}}, Batch: 1, Output: "INSERT INTO `t` VALUES\n('it\\'s');\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a\\b\"c\nd\re\tf\x00g\x1a")}}, Batch: 1, Output: "INSERT INTO `t` VALUES\n('a\\\\b\\\"c\\nd\\re\\tf\\0g\\Z');\n"},
+	{Input: [][]sql.RawBytes{{[]byte("1")}, {[]byte("2")}}, Batch: 1, Output: "INSERT INTO `t` VALUES\n('1');\nINSERT INTO `t` VALUES\n('2');\n"},
+	{Input: [][]sql.RawBytes{{[]byte("1")}, {[]byte("2")}, {[]byte("3")}}, Batch: 2, Output: "INSERT INTO `t` VALUES\n('1'),\n('2');\nINSERT INTO `t` VALUES\n('3');\n"},
+	{Input: [][]sql.RawBytes{{[]byte("1")}, {[]byte("2")}}, Batch: 5, Output: "INSERT INTO `t` VALUES\n('1'),\n('2');\n"},
+}
+
+func TestSQLWrite(t *testing.T) {
+	for n, tt := range sqlWriteTests {
+		b := &bytes.Buffer{}
+		f := NewSQLWriter(b)
+		f.Table = "t"
+		f.Batch = tt.Batch
+		if tt.Header != nil {
+			f.WriteHeader(tt.Header)
+		}
+		for _, record := range tt.Input {
+			_, err := f.Write(record)
+			if err != nil {
+				t.Errorf("Unexpected error: %s\n", err)
+			}
+		}
+		err := f.Close()
+		if err != nil {
+			t.Errorf("Unexpected error: %s\n", err)
+		}
+		got := b.String()
+		if got != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestSQLWriteQualifiedTable(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewSQLWriter(b)
+	f.Table = "db.t"
+	f.Write([]sql.RawBytes{[]byte("1")})
+	f.Close()
+
+	want := "INSERT INTO `db`.`t` VALUES\n('1');\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// oracleName matches identifiers that can be written without quotes, Oracle folds them to
+// upper case so they match tables created without quoted column names
+var oracleName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*$`)
+
+// controlFileName returns the SQL*Loader control file name for an output file
+func controlFileName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".ctl"
+}
+
+// writeControlFile writes a SQL*Loader control file that loads infile into table. The field
+// and record separators match the export settings in exi and cols lists every output column.
+func writeControlFile(w io.Writer, table string, infile string, exi exportInfo, cols []column) error {
+	var b bytes.Buffer
+
+	if exi.header {
+		b.WriteString("OPTIONS (SKIP=1)\n")
+	}
+	b.WriteString("LOAD DATA\n")
+	fmt.Fprintf(&b, "INFILE '%s' \"STR %s\"\n", strings.Replace(infile, "'", "''", -1), ctlLiteral(exi.terminator))
+	b.WriteString("APPEND\n")
+	fmt.Fprintf(&b, "INTO TABLE %s\n", table)
+	fmt.Fprintf(&b, "FIELDS TERMINATED BY %s", ctlLiteral(exi.delimiter))
+	if exi.quote != "" {
+		fmt.Fprintf(&b, " OPTIONALLY ENCLOSED BY %s", ctlLiteral(exi.quote))
+	}
+	b.WriteString("\nTRAILING NULLCOLS\n(\n")
+
+	// SQL*Loader loads empty fields as NULL without being told
+	null := ctlLiteral(exi.nullString)
+	for i, c := range cols {
+		name := c.name
+		if !oracleName.MatchString(name) {
+			name = `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+		}
+
+		fmt.Fprintf(&b, "  %s %s", name, ctlField(c, exi.binary))
+		if exi.nullString != "" {
+			fmt.Fprintf(&b, " NULLIF %s=%s", name, null)
+		}
+		if i < len(cols)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ctlField returns the SQL*Loader field specification for a MySQL column type. Text fields
+// are sized generously since SQL*Loader rejects values longer than the CHAR length.
+func ctlField(c column, binary string) string {
+	switch strings.TrimPrefix(c.dbType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return "INTEGER EXTERNAL"
+	case "DECIMAL":
+		return "DECIMAL EXTERNAL"
+	case "FLOAT", "DOUBLE":
+		return "FLOAT EXTERNAL"
+	case "DATE":
+		return `DATE "YYYY-MM-DD"`
+	case "DATETIME", "TIMESTAMP":
+		if c.info != nil {
+			if _, scale, ok := c.info.DecimalSize(); ok && scale > 0 {
+				return `TIMESTAMP "YYYY-MM-DD HH24:MI:SS.FF"`
+			}
+		}
+		return `TIMESTAMP "YYYY-MM-DD HH24:MI:SS"`
+	case "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT", "JSON", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return "CHAR(1000000)"
+	case "BINARY", "VARBINARY":
+		if binary != "raw" {
+			return "CHAR(1000000)"
+		}
+	}
+
+	return "CHAR(4000)"
+}
+
+// ctlLiteral quotes s as a SQL*Loader string, non printable strings are written in hex
+func ctlLiteral(s string) string {
+	for _, r := range s {
+		if r < ' ' || r > '~' || r == '\'' || r == '\\' {
+			return "X'" + strings.ToUpper(hex.EncodeToString([]byte(s))) + "'"
+		}
+	}
+
+	return "'" + s + "'"
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteControlFile(t *testing.T) {
+	b := &bytes.Buffer{}
+	exi := exportInfo{header: true, delimiter: "|", quote: "\"", escape: "\\", nullString: `\N`, terminator: "\r\n", binary: "raw"}
+	cols := []column{{name: "id", dbType: "UNSIGNED BIGINT"}, {name: "Full Name", dbType: "VARCHAR"}, {name: "created", dbType: "DATETIME"}, {name: "notes", dbType: "TEXT"}}
+	err := writeControlFile(b, "scott.people", "people.csv", exi, cols)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := "OPTIONS (SKIP=1)\n" +
+		"LOAD DATA\n" +
+		"INFILE 'people.csv' \"STR X'0D0A'\"\n" +
+		"APPEND\n" +
+		"INTO TABLE scott.people\n" +
+		"FIELDS TERMINATED BY '|' OPTIONALLY ENCLOSED BY '\"'\n" +
+		"TRAILING NULLCOLS\n" +
+		"(\n" +
+		"  id INTEGER EXTERNAL NULLIF id=X'5C4E',\n" +
+		"  \"Full Name\" CHAR(4000) NULLIF \"Full Name\"=X'5C4E',\n" +
+		"  created TIMESTAMP \"YYYY-MM-DD HH24:MI:SS\" NULLIF created=X'5C4E',\n" +
+		"  notes CHAR(1000000) NULLIF notes=X'5C4E'\n" +
+		")\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=\n%s\nwant=\n%s", got, want)
+	}
+}
+
+func TestControlFileName(t *testing.T) {
+	tests := map[string]string{"my.csv": "my.ctl", "/tmp/out": "/tmp/out.ctl", "a.b/c.csv": "a.b/c.ctl"}
+	for name, want := range tests {
+		if got := controlFileName(name); got != want {
+			t.Errorf("controlFileName(%q)=%q want %q", name, got, want)
+		}
+	}
+}
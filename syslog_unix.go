@@ -0,0 +1,22 @@
+// +build linux darwin
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// openSyslog connects to the local syslog daemon, or to addr given as host:port for UDP or
+// tcp://host:port & udp://host:port
+func openSyslog(addr string) (auditLog, error) {
+	network := ""
+	if addr != "" {
+		network = "udp"
+		if i := strings.Index(addr, "://"); i >= 0 {
+			network, addr = addr[:i], addr[i+3:]
+		}
+	}
+
+	return syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, "mycsv")
+}
@@ -0,0 +1,10 @@
+// +build windows
+
+package main
+
+// openSyslog warns that syslog is not available, exports are not audited on windows
+func openSyslog(addr string) (auditLog, error) {
+	logger.Println("Warning: syslog is not supported in windows, the export will not be audited!")
+
+	return nil, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A TableWriter writes records as an aligned text table like the mysql client's output.
+//
+// Column widths are sized from the header and the first Sample records, which are buffered
+// until the widths are known. Later records are streamed and values wider than their column
+// are written in full, breaking alignment rather than losing data. nil fields are written as NULL.
+type TableWriter struct {
+	Sample int // Number of records used to size columns (set to 1000 by NewTableWriter)
+	header []string
+	rows   [][]string
+	widths []int
+	ready  bool
+	w      *bufio.Writer
+}
+
+// NewTableWriter returns a new TableWriter that writes to w.
+func NewTableWriter(w io.Writer) *TableWriter {
+	return NewTableWriterSize(w, 4096)
+}
+
+// NewTableWriterSize returns a new TableWriter that writes to w and buffers at least size bytes
+// between writes to the underlying io.Writer.
+func NewTableWriterSize(w io.Writer, size int) *TableWriter {
+	return &TableWriter{
+		Sample: 1000,
+		w:      bufio.NewWriterSize(w, size),
+	}
+}
+
+// WriteHeader sets the column names written at the top of the table.
+func (w *TableWriter) WriteHeader(cols []sql.RawBytes) (int, error) {
+	w.header = cells(cols)
+	return w.w.Buffered(), nil
+}
+
+// Write writes a single record as a table row.
+func (w *TableWriter) Write(record []sql.RawBytes) (buf int, err error) {
+	row := cells(record)
+	if w.ready {
+		err = w.writeRow(row)
+		return w.w.Buffered(), err
+	}
+
+	// Buffer rows until there are enough to size the columns
+	w.rows = append(w.rows, row)
+	if len(w.rows) >= w.Sample {
+		err = w.layout()
+	}
+
+	return w.w.Buffered(), err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// Rows held to size the columns are not written until the sample is complete.
+// To check if an error occurred during the Flush, call Error.
+func (w *TableWriter) Flush() {
+	w.w.Flush()
+}
+
+// Close writes any rows held for column sizing and the closing border, then flushes the output.
+func (w *TableWriter) Close() error {
+	if !w.ready {
+		if err := w.layout(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.writeBorder(); err != nil {
+		return err
+	}
+
+	return w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *TableWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// layout sizes the columns and writes the table header and buffered rows
+func (w *TableWriter) layout() error {
+	w.ready = true
+
+	for _, row := range append([][]string{w.header}, w.rows...) {
+		for i, cell := range row {
+			if i >= len(w.widths) {
+				w.widths = append(w.widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > w.widths[i] {
+				w.widths[i] = n
+			}
+		}
+	}
+
+	if err := w.writeBorder(); err != nil {
+		return err
+	}
+
+	if w.header != nil {
+		if err := w.writeRow(w.header); err != nil {
+			return err
+		}
+		if err := w.writeBorder(); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range w.rows {
+		if err := w.writeRow(row); err != nil {
+			return err
+		}
+	}
+	w.rows = nil
+
+	return nil
+}
+
+// writeBorder writes a +----+ separator line
+func (w *TableWriter) writeBorder() error {
+	var b strings.Builder
+	b.WriteString("+")
+	for _, width := range w.widths {
+		b.WriteString(strings.Repeat("-", width+2))
+		b.WriteString("+")
+	}
+	b.WriteString("\n")
+
+	_, err := w.w.WriteString(b.String())
+	return err
+}
+
+// writeRow writes a | cell | line padding each cell to its column width
+func (w *TableWriter) writeRow(row []string) error {
+	var b strings.Builder
+	b.WriteString("|")
+	for i, cell := range row {
+		b.WriteString(" ")
+		b.WriteString(cell)
+		if i < len(w.widths) {
+			if pad := w.widths[i] - utf8.RuneCountInString(cell); pad > 0 {
+				b.WriteString(strings.Repeat(" ", pad))
+			}
+		}
+		b.WriteString(" |")
+	}
+	b.WriteString("\n")
+
+	_, err := w.w.WriteString(b.String())
+	return err
+}
+
+// cells copies a record to strings, nil fields become NULL
+func cells(record []sql.RawBytes) []string {
+	row := make([]string, len(record))
+	for i, field := range record {
+		if field == nil {
+			row[i] = "NULL"
+		} else {
+			row[i] = string(field)
+		}
+	}
+
+	return row
+}
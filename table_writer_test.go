@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestTableWrite(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewTableWriter(b)
+	f.WriteHeader([]sql.RawBytes{[]byte("id"), []byte("name")})
+	f.Write([]sql.RawBytes{[]byte("1"), []byte("abc")})
+	f.Write([]sql.RawBytes{[]byte("22"), nil})
+	f.Write([]sql.RawBytes{[]byte("3"), []byte("über")})
+	err := f.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	want := "+----+------+\n" +
+		"| id | name |\n" +
+		"+----+------+\n" +
+		"| 1  | abc  |\n" +
+		"| 22 | NULL |\n" +
+		"| 3  | über |\n" +
+		"+----+------+\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=\n%s\nwant=\n%s", got, want)
+	}
+}
+
+func TestTableWriteSample(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewTableWriter(b)
+	f.Sample = 1
+	f.Write([]sql.RawBytes{[]byte("a")})
+	f.Write([]sql.RawBytes{[]byte("bbb")})
+	err := f.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	// Rows after the sample are streamed and may overflow their column
+	want := "+---+\n" +
+		"| a |\n" +
+		"| bbb |\n" +
+		"+---+\n"
+	if got := b.String(); got != want {
+		t.Errorf("got=\n%s\nwant=\n%s", got, want)
+	}
+}
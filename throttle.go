@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// A throttle limits how fast rows are written using a token bucket that holds at most
+// one second worth of rows. The bucket starts empty so the rate is smooth from the first row.
+type throttle struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newThrottle returns a throttle allowing rate rows per second
+func newThrottle(rate int) *throttle {
+	return &throttle{rate: float64(rate), last: time.Now()}
+}
+
+// wait blocks until another row may be written
+func (t *throttle) wait() {
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+
+	if t.tokens < 1 {
+		delay := time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+		time.Sleep(delay)
+		t.tokens = 0
+		t.last = now.Add(delay)
+		return
+	}
+	t.tokens--
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	start := time.Now()
+	th := newThrottle(1000)
+	for i := 0; i < 50; i++ {
+		th.wait()
+	}
+
+	// 50 rows at 1000 rows per second takes about 50ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("50 rows at 1000 rows/sec took %v", elapsed)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// customTLS is the DSN tls config name connections using -ca, -cert & -key are registered under
+const customTLS = "custom"
+
+// newTLSConfig returns a TLS config that verifies the server against the PEM encoded CA
+// certificates in ca, or the system roots when ca is empty, and presents the client
+// certificate in cert & key if given. skipVerify turns off server verification.
+func newTLSConfig(ca string, cert string, key string, skipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s does not contain a PEM encoded certificate", ca)
+		}
+	}
+
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	return cfg, nil
+}
+
+// registerTLSFiles registers the config newTLSConfig returns for the mysql driver, the driver
+// verifies the server certificate is for the host being connected to
+func registerTLSFiles(ca string, cert string, key string, skipVerify bool) error {
+	cfg, err := newTLSConfig(ca, cert, key, skipVerify)
+	if err != nil {
+		return err
+	}
+
+	return mysql.RegisterTLSConfig(customTLS, cfg)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "mycsv-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The test server's certificate is self signed so it is its own CA
+	ca := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Handshake over an in memory connection using the test server's certificate
+	dial := func(cfg *tls.Config, host string) error {
+		c, s := net.Pipe()
+		defer c.Close()
+		go func() {
+			tls.Server(s, srv.TLS).Handshake()
+			s.Close()
+		}()
+		cfg.ServerName = host
+		return tls.Client(c, cfg).Handshake()
+	}
+
+	cfg, err := newTLSConfig(ca, "", "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if err := dial(cfg, "example.com"); err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if err := dial(cfg.Clone(), "db1"); err == nil {
+		t.Error("expected a host name error")
+	}
+
+	cfg, err = newTLSConfig("", "", "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if err := dial(cfg, "example.com"); err == nil {
+		t.Error("expected an unknown authority error")
+	}
+
+	if _, err := newTLSConfig(filepath.Join(dir, "missing.pem"), "", "", false); err == nil {
+		t.Error("expected an error for a missing CA file")
+	}
+	if _, err := newTLSConfig(ca, ca, ca, false); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+}
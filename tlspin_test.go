@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	want := sha256.Sum256([]byte("cert"))
+	for _, pin := range []string{
+		fmt.Sprintf("sha256:%x", want),
+		fmt.Sprintf("sha256:%X", want),
+		"sha256:" + strings.ToUpper(fmt.Sprintf("% x", want[:])),
+	} {
+		pin = strings.Replace(pin, " ", ":", -1)
+		got, err := parsePin(pin)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s\n", pin, err)
+		} else if string(got) != string(want[:]) {
+			t.Errorf("%s: got=%x want=%x", pin, got, want)
+		}
+	}
+
+	for _, pin := range []string{"", fmt.Sprintf("%x", want), "sha256:abc", fmt.Sprintf("sha1:%x", want[:20])} {
+		if _, err := parsePin(pin); err == nil {
+			t.Errorf("%q: expected an error", pin)
+		}
+	}
+}
+
+func TestPinVerifier(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().Raw)
+
+	// Handshake over an in memory connection using the test server's certificate
+	dial := func(pin []byte) error {
+		c, s := net.Pipe()
+		defer c.Close()
+		go func() {
+			tls.Server(s, srv.TLS).Handshake()
+			s.Close()
+		}()
+		return tls.Client(c, &tls.Config{InsecureSkipVerify: true, VerifyPeerCertificate: pinVerifier(pin)}).Handshake()
+	}
+
+	if err := dial(sum[:]); err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+
+	other := sha256.Sum256([]byte("other"))
+	if err := dial(other[:]); err == nil || !strings.Contains(err.Error(), "TLS pinning failed") {
+		t.Errorf("expected a pinning error, got %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// splitList splits a comma separated flag value into its trimmed, non empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// listFlag collects every value of a flag that may be repeated
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// resolveColumns pairs column names with the driver's type information. When ColumnTypes
+// failed, returned the wrong number of columns or has no type name for a column, that column
+// is treated as TEXT and false is returned so the caller can warn type based options are limited.
+func resolveColumns(cols []string, types []*sql.ColumnType, err error) ([]column, bool) {
+	typed := err == nil && len(types) == len(cols)
+	complete := typed
+
+	columns := make([]column, len(cols))
+	for i, col := range cols {
+		columns[i] = column{name: col, dbType: "TEXT"}
+		if !typed {
+			continue
+		}
+
+		columns[i].info = types[i]
+		if name := types[i].DatabaseTypeName(); name != "" {
+			columns[i].dbType = name
+		} else {
+			complete = false
+		}
+	}
+
+	return columns, complete
+}
+
+// columnNames returns the names of columns as a record
+func columnNames(columns []column) []sql.RawBytes {
+	names := make([]sql.RawBytes, len(columns))
+	for i, col := range columns {
+		names[i] = []byte(col.name)
+	}
+
+	return names
+}
+
+// dedupNames returns cols with repeated names renamed by a numeric suffix, id, id becomes
+// id, id_2, along with each name that was repeated. Names are compared case insensitively.
+func dedupNames(cols []string) ([]string, []string) {
+	seen := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		seen[strings.ToLower(col)] = true
+	}
+
+	out := make([]string, len(cols))
+	used := make(map[string]bool, len(cols))
+	repeated := make(map[string]bool)
+	var dups []string
+	for i, col := range cols {
+		out[i] = col
+		if !used[strings.ToLower(col)] {
+			used[strings.ToLower(col)] = true
+			continue
+		}
+
+		if !repeated[strings.ToLower(col)] {
+			repeated[strings.ToLower(col)] = true
+			dups = append(dups, col)
+		}
+		for n := 2; ; n++ {
+			name := col + "_" + strconv.Itoa(n)
+			if !seen[strings.ToLower(name)] && !used[strings.ToLower(name)] {
+				out[i] = name
+				used[strings.ToLower(name)] = true
+				break
+			}
+		}
+	}
+
+	return out, dups
+}
+
+// typeMask returns a slice the length of columns with true set for each column of a MySQL type
+func typeMask(columns []column, dbTypes ...string) []bool {
+	mask := make([]bool, len(columns))
+	for i, col := range columns {
+		for _, t := range dbTypes {
+			if col.dbType == t {
+				mask[i] = true
+			}
+		}
+	}
+
+	return mask
+}
+
+// columnMask returns a slice the length of cols with true set for each named column.
+// Names are matched case insensitively unless caseSensitive is set.
+func columnMask(cols []sql.RawBytes, names []string, caseSensitive bool) ([]bool, error) {
+	mask := make([]bool, len(cols))
+	for _, name := range names {
+		found := false
+		for i, col := range cols {
+			if columnMatch(string(col), name, caseSensitive) {
+				mask[i] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("column %q not found in query results", name)
+		}
+	}
+
+	return mask, nil
+}
+
+// columnMatch reports if a column name matches a user supplied name
+func columnMatch(col string, name string, caseSensitive bool) bool {
+	if caseSensitive {
+		return col == name
+	}
+
+	return strings.EqualFold(col, name)
+}
+
+// trimFields strips leading and trailing whitespace from each masked field, NULLs are left untouched
+func trimFields(record []sql.RawBytes, mask []bool) {
+	for i, field := range record {
+		if mask[i] && field != nil {
+			trimmed := bytes.TrimSpace(field)
+
+			// TrimSpace returns nil for an all whitespace field which would be written as NULL
+			if trimmed == nil {
+				trimmed = field[:0]
+			}
+			record[i] = trimmed
+		}
+	}
+}
+
+// nullFields replaces fields equal to one of values with NULL, ignoring case when fold is set
+func nullFields(record []sql.RawBytes, values [][]byte, fold bool) {
+	for i, field := range record {
+		if field == nil {
+			continue
+		}
+		for _, v := range values {
+			if bytes.Equal(field, v) || fold && bytes.EqualFold(field, v) {
+				record[i] = nil
+				break
+			}
+		}
+	}
+}
+
+// wktFields converts each masked MySQL geometry field to WKT, fields that fail to decode are left as is
+func wktFields(record []sql.RawBytes, mask []bool) {
+	for i, field := range record {
+		if mask[i] && field != nil {
+			wkt, err := geometryToWKT(field)
+			if err == nil {
+				record[i] = wkt
+			}
+		}
+	}
+}
+
+// encodeFields hex or base64 encodes each masked field, NULLs are left untouched
+func encodeFields(record []sql.RawBytes, mask []bool, encoding string) {
+	for i, field := range record {
+		if mask[i] && field != nil {
+			switch encoding {
+			case "hex":
+				record[i] = []byte(hex.EncodeToString(field))
+			case "base64":
+				record[i] = []byte(base64.StdEncoding.EncodeToString(field))
+			}
+		}
+	}
+}
+
+// formatFloats reformats masked fields with a fmt verb such as %.2f, fields that do not
+// parse as a number are left as they are
+func formatFloats(record []sql.RawBytes, mask []bool, format string) {
+	for i, field := range record {
+		if mask[i] && field != nil {
+			f, err := strconv.ParseFloat(string(field), 64)
+			if err == nil {
+				record[i] = []byte(fmt.Sprintf(format, f))
+			}
+		}
+	}
+}
+
+// groupedNumber matches a number with comma thousands separators such as MySQL's FORMAT() returns
+var groupedNumber = regexp.MustCompile(`^-?[0-9]{1,3}(,[0-9]{3})+(\.[0-9]+)?$`)
+
+// formatNumbers applies a -number-format mode to a record. strip removes the separators from
+// every field that is a grouped number, whatever its column type, as text columns are where
+// grouped numbers come from. group adds separators to the masked numeric fields.
+func formatNumbers(record []sql.RawBytes, mask []bool, mode string) {
+	for i, field := range record {
+		if field == nil {
+			continue
+		}
+		switch {
+		case mode == "strip" && groupedNumber.Match(field):
+			record[i] = bytes.Replace(field, []byte(","), nil, -1)
+		case mode == "group" && mask[i]:
+			record[i] = groupDigits(field)
+		}
+	}
+}
+
+// groupDigits inserts a comma every 3 digits of the integer part of a decimal number, values
+// that are not plain decimal numbers such as 1e+30 are returned as they are
+func groupDigits(field []byte) []byte {
+	start := 0
+	if len(field) > 0 && (field[0] == '-' || field[0] == '+') {
+		start = 1
+	}
+	end := start
+	for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+		end++
+	}
+	if end == start || end-start <= 3 {
+		return field
+	}
+	if end < len(field) && (field[end] != '.' || bytes.IndexAny(field[end+1:], "eE.") >= 0) {
+		return field
+	}
+
+	digits := field[start:end]
+	out := make([]byte, 0, len(field)+len(digits)/3)
+	out = append(out, field[:start]...)
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, d)
+	}
+
+	return append(out, field[end:]...)
+}
+
+// A padSpec pads a column's values to a width in characters
+type padSpec struct {
+	col   string
+	width int
+	align string // left, right or zero
+}
+
+// parsePad parses a -pad value of the form col:width:align, align defaults to right. The
+// column name may itself contain colons.
+func parsePad(spec string) (padSpec, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 {
+		return padSpec{}, fmt.Errorf("-pad %q must be col:width or col:width:align", spec)
+	}
+
+	p := padSpec{align: "right"}
+	switch last := parts[len(parts)-1]; last {
+	case "left", "right", "zero":
+		p.align = last
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 2 {
+		return padSpec{}, fmt.Errorf("-pad %q must be col:width or col:width:align", spec)
+	}
+
+	width, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil || width < 1 {
+		return padSpec{}, fmt.Errorf("-pad %q width must be a positive number", spec)
+	}
+	p.width = width
+	p.col = strings.Join(parts[:len(parts)-1], ":")
+	if p.col == "" {
+		return padSpec{}, fmt.Errorf("-pad %q has no column", spec)
+	}
+
+	return p, nil
+}
+
+// padColumns returns a slice the length of cols holding the pad for each padded column, a
+// column named by more than one -pad uses the last
+func padColumns(cols []sql.RawBytes, pads []padSpec, caseSensitive bool) ([]*padSpec, error) {
+	out := make([]*padSpec, len(cols))
+	for n := range pads {
+		mask, err := columnMask(cols, []string{pads[n].col}, caseSensitive)
+		if err != nil {
+			return nil, err
+		}
+		for i := range mask {
+			if mask[i] {
+				out[i] = &pads[n]
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// padFields pads each field with a pad to its width, counting characters rather than bytes
+// so UTF-8 values align. Fields already as wide are left as they are, NULLs are left untouched.
+// zero pads with 0s after any sign.
+func padFields(record []sql.RawBytes, pads []*padSpec) {
+	for i, field := range record {
+		p := pads[i]
+		if p == nil || field == nil {
+			continue
+		}
+		n := p.width - utf8.RuneCount(field)
+		if n <= 0 {
+			continue
+		}
+
+		out := make([]byte, 0, len(field)+n)
+		switch p.align {
+		case "left":
+			out = append(append(out, field...), bytes.Repeat([]byte(" "), n)...)
+		case "right":
+			out = append(append(out, bytes.Repeat([]byte(" "), n)...), field...)
+		case "zero":
+			sign := 0
+			if len(field) > 0 && (field[0] == '-' || field[0] == '+') {
+				sign = 1
+			}
+			out = append(append(append(out, field[:sign]...), bytes.Repeat([]byte("0"), n)...), field[sign:]...)
+		}
+		record[i] = out
+	}
+}
+
+// boolFormats are the false & true values written for each -bool-format
+var boolFormats = map[string][2]string{
+	"01":        {"0", "1"},
+	"truefalse": {"false", "true"},
+	"yn":        {"n", "y"},
+}
+
+// formatBools replaces masked BIT fields with the false or true value of format. BIT values
+// are big endian bytes, values other than 0 & 1 from wider columns are written as integers.
+func formatBools(record []sql.RawBytes, mask []bool, format string) {
+	values := boolFormats[format]
+	for i, field := range record {
+		if mask[i] && field != nil {
+			var n uint64
+			for _, b := range field {
+				n = n<<8 | uint64(b)
+			}
+
+			switch n {
+			case 0, 1:
+				record[i] = []byte(values[n])
+			default:
+				record[i] = strconv.AppendUint(nil, n, 10)
+			}
+		}
+	}
+}
+
+// prependFields fills out with the constant fields followed by the record fields
+func prependFields(out []sql.RawBytes, constants []sql.RawBytes, record []sql.RawBytes) []sql.RawBytes {
+	n := copy(out, constants)
+	copy(out[n:], record)
+
+	return out
+}
+
+// rowHash returns the hex encoded hash of the raw field values of a record. Each field is
+// hashed with its length so field boundaries, empty strings and NULLs all change the hash.
+func rowHash(h hash.Hash, record []sql.RawBytes) sql.RawBytes {
+	h.Reset()
+
+	var n [binary.MaxVarintLen64]byte
+	for _, field := range record {
+		// NULL is length 0, other fields are their length + 1
+		var length uint64
+		if field != nil {
+			length = uint64(len(field)) + 1
+		}
+		h.Write(n[:binary.PutUvarint(n[:], length)])
+		h.Write(field)
+	}
+
+	sum := h.Sum(nil)
+	out := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(out, sum)
+
+	return out
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestColumnMask(t *testing.T) {
+	cols := []sql.RawBytes{[]byte("a"), []byte("b"), []byte("c")}
+
+	mask, err := columnMask(cols, []string{"a", "c"}, true)
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(mask, want) {
+		t.Errorf("got=%v want=%v", mask, want)
+	}
+
+	_, err = columnMask(cols, []string{"d"}, true)
+	if err == nil {
+		t.Error("Error should not be nil")
+	}
+
+	mask, err = columnMask(cols, []string{"B"}, false)
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if want := []bool{false, true, false}; !reflect.DeepEqual(mask, want) {
+		t.Errorf("got=%v want=%v", mask, want)
+	}
+
+	_, err = columnMask(cols, []string{"B"}, true)
+	if err == nil {
+		t.Error("Error should not be nil")
+	}
+}
+
+func TestTrimFields(t *testing.T) {
+	record := []sql.RawBytes{[]byte(" a "), []byte(" b "), []byte("   "), nil}
+	trimFields(record, []bool{true, false, true, true})
+
+	if string(record[0]) != "a" {
+		t.Errorf("got=%q want=%q", record[0], "a")
+	}
+	if string(record[1]) != " b " {
+		t.Errorf("got=%q want=%q", record[1], " b ")
+	}
+	if record[2] == nil || len(record[2]) != 0 {
+		t.Errorf("got=%q want empty non NULL field", record[2])
+	}
+	if record[3] != nil {
+		t.Errorf("got=%q want NULL", record[3])
+	}
+}
+
+func TestEncodeFields(t *testing.T) {
+	record := []sql.RawBytes{[]byte("\x00\xff"), []byte("text"), nil}
+	encodeFields(record, []bool{true, false, true}, "hex")
+	if string(record[0]) != "00ff" || string(record[1]) != "text" || record[2] != nil {
+		t.Errorf("got=%q", record)
+	}
+
+	record = []sql.RawBytes{[]byte("\x00\xff"), []byte("text"), nil}
+	encodeFields(record, []bool{true, false, true}, "base64")
+	if string(record[0]) != "AP8=" || string(record[1]) != "text" || record[2] != nil {
+		t.Errorf("got=%q", record)
+	}
+}
+
+var dedupTests = []struct {
+	Input  []string
+	Output []string
+	Dups   []string
+}{
+	{Input: []string{"a", "b"}, Output: []string{"a", "b"}},
+	{Input: []string{"id", "name", "id"}, Output: []string{"id", "name", "id_2"}, Dups: []string{"id"}},
+	{Input: []string{"id", "id", "ID"}, Output: []string{"id", "id_2", "ID_3"}, Dups: []string{"id"}},
+	{Input: []string{"id", "id_2", "id"}, Output: []string{"id", "id_2", "id_3"}, Dups: []string{"id"}},
+}
+
+func TestDedupNames(t *testing.T) {
+	for n, tt := range dedupTests {
+		got, dups := dedupNames(tt.Input)
+		if !reflect.DeepEqual(got, tt.Output) || !reflect.DeepEqual(dups, tt.Dups) {
+			t.Errorf("#%d: got=%v, %v want=%v, %v", n, got, dups, tt.Output, tt.Dups)
+		}
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	h := sha1.New()
+	a := string(rowHash(h, []sql.RawBytes{[]byte("ab"), []byte("c")}))
+	if len(a) != 40 {
+		t.Errorf("sha1 hash %q should be 40 hex characters", a)
+	}
+	if b := string(rowHash(h, []sql.RawBytes{[]byte("ab"), []byte("c")})); a != b {
+		t.Errorf("hash is not stable, got=%q want=%q", b, a)
+	}
+
+	// Field boundaries & NULLs must change the hash
+	distinct := map[string]bool{a: true}
+	for _, record := range [][]sql.RawBytes{
+		{[]byte("a"), []byte("bc")},
+		{[]byte("abc")},
+		{[]byte("ab"), []byte("c"), nil},
+		{[]byte("ab"), []byte("c"), []byte("")},
+	} {
+		got := string(rowHash(h, record))
+		if distinct[got] {
+			t.Errorf("%q hashes the same as another record", record)
+		}
+		distinct[got] = true
+	}
+
+	if got := rowHash(xxhash.New(), []sql.RawBytes{[]byte("abc")}); len(got) != 16 {
+		t.Errorf("xxhash hash %q should be 16 hex characters", got)
+	}
+}
+
+func TestResolveColumnsFallback(t *testing.T) {
+	want := []column{{name: "a", dbType: "TEXT"}, {name: "b", dbType: "TEXT"}}
+
+	got, complete := resolveColumns([]string{"a", "b"}, nil, errors.New("not supported"))
+	if complete || !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, %v want=%v, false", got, complete, want)
+	}
+
+	got, complete = resolveColumns([]string{"a", "b"}, []*sql.ColumnType{}, nil)
+	if complete || !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, %v want=%v, false", got, complete, want)
+	}
+}
+
+func TestResolveColumnsMissingType(t *testing.T) {
+	db := newStubDB(map[string]stubResult{"select a, b, c": {cols: []string{"a", "b", "c"}, types: []string{"INT", "", "VARCHAR"}}})
+	defer db.Close()
+	rows, err := db.Query("select a, b, c")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	types, err := rows.ColumnTypes()
+
+	got, complete := resolveColumns(cols, types, err)
+	if complete {
+		t.Error("complete=true want false")
+	}
+	for i, want := range []string{"INT", "TEXT", "VARCHAR"} {
+		if got[i].dbType != want {
+			t.Errorf("#%d: got=%q want=%q", i, got[i].dbType, want)
+		}
+		if got[i].info != types[i] {
+			t.Errorf("#%d: info not kept", i)
+		}
+	}
+}
+
+func TestFormatFloats(t *testing.T) {
+	record := []sql.RawBytes{[]byte("3.14159"), []byte("1.5e-7"), nil, []byte("abc"), []byte("2.71828")}
+	mask := []bool{true, true, true, true, false}
+	formatFloats(record, mask, "%.2f")
+
+	want := []sql.RawBytes{[]byte("3.14"), []byte("0.00"), nil, []byte("abc"), []byte("2.71828")}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got=%q want=%q", record, want)
+	}
+}
+
+func TestFormatBools(t *testing.T) {
+	record := []sql.RawBytes{[]byte{0}, []byte{1}, nil, []byte{1, 2}, []byte{1}}
+	mask := []bool{true, true, true, true, false}
+	formatBools(record, mask, "truefalse")
+
+	want := []sql.RawBytes{[]byte("false"), []byte("true"), nil, []byte("258"), []byte{1}}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got=%q want=%q", record, want)
+	}
+}
+
+func TestNullFields(t *testing.T) {
+	values := [][]byte{[]byte("N/A"), []byte("-")}
+
+	record := []sql.RawBytes{[]byte("N/A"), []byte("n/a"), []byte("-"), []byte("--"), nil, []byte("")}
+	nullFields(record, values, false)
+	want := []sql.RawBytes{nil, []byte("n/a"), nil, []byte("--"), nil, []byte("")}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got=%q want=%q", record, want)
+	}
+
+	record = []sql.RawBytes{[]byte("N/A"), []byte("n/a"), []byte("x")}
+	nullFields(record, values, true)
+	want = []sql.RawBytes{nil, nil, []byte("x")}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got=%q want=%q", record, want)
+	}
+}
+
+var numberTests = []struct {
+	mode   string
+	masked bool
+	in     string
+	out    string
+}{
+	{"group", true, "1234567", "1,234,567"},
+	{"group", true, "-1234567.125", "-1,234,567.125"},
+	{"group", true, "123", "123"},
+	{"group", true, "1000", "1,000"},
+	{"group", true, "123456.5", "123,456.5"},
+	{"group", true, "1e+30", "1e+30"},
+	{"group", true, "1.5e+30", "1.5e+30"},
+	{"group", false, "1234567", "1234567"},
+	{"strip", false, "1,234,567.50", "1234567.50"},
+	{"strip", true, "-1,000", "-1000"},
+	{"strip", false, "1,2,3", "1,2,3"},
+	{"strip", false, "a,000", "a,000"},
+	{"strip", false, "1234", "1234"},
+}
+
+func TestFormatNumbers(t *testing.T) {
+	for n, tt := range numberTests {
+		record := []sql.RawBytes{[]byte(tt.in), nil}
+		formatNumbers(record, []bool{tt.masked, true}, tt.mode)
+		if string(record[0]) != tt.out || record[1] != nil {
+			t.Errorf("#%d: %s %q got=%q want=%q", n, tt.mode, tt.in, record, tt.out)
+		}
+	}
+}
+
+func TestParsePad(t *testing.T) {
+	for spec, want := range map[string]padSpec{
+		"id:8:zero":  {col: "id", width: 8, align: "zero"},
+		"name:20":    {col: "name", width: 20, align: "right"},
+		"a:b:5:left": {col: "a:b", width: 5, align: "left"},
+	} {
+		got, err := parsePad(spec)
+		if err != nil || got != want {
+			t.Errorf("%q: got=%+v err=%v want=%+v", spec, got, err, want)
+		}
+	}
+
+	for _, spec := range []string{"id", "id:0", "id:x:left", ":5", "5:left"} {
+		if _, err := parsePad(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestPadFields(t *testing.T) {
+	left := &padSpec{width: 5, align: "left"}
+	right := &padSpec{width: 5, align: "right"}
+	zero := &padSpec{width: 5, align: "zero"}
+	record := []sql.RawBytes{[]byte("ab"), []byte("señor"), []byte("-42"), []byte("né"), nil, []byte("toolong"), []byte("x"), sql.RawBytes("")}
+	padFields(record, []*padSpec{left, right, zero, right, right, left, nil, zero})
+
+	want := []string{"ab   ", "señor", "-0042", "   né", "", "toolong", "x", "00000"}
+	for i := range want {
+		if string(record[i]) != want[i] {
+			t.Errorf("#%d: got=%q want=%q", i, record[i], want[i])
+		}
+	}
+	if record[4] != nil {
+		t.Errorf("got=%q want NULL", record[4])
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mysqlTime matches TIME values, which can be negative and exceed 24 hours
+var mysqlTime = regexp.MustCompile(`^-?\d{2,3}:\d{2}:\d{2}(\.\d+)?$`)
+
+// A typeChecker samples the first rows of an export and counts values that do not parse as
+// their column's declared type. Columns of types it has no check for are ignored.
+type typeChecker struct {
+	columns  []column
+	checks   []func([]byte) bool
+	bad      []uint
+	examples [][]byte
+	rows     int
+	max      int
+}
+
+// newTypeChecker returns a typeChecker sampling up to max rows of columns
+func newTypeChecker(columns []column, max int) *typeChecker {
+	c := &typeChecker{
+		columns:  columns,
+		checks:   make([]func([]byte) bool, len(columns)),
+		bad:      make([]uint, len(columns)),
+		examples: make([][]byte, len(columns)),
+		max:      max,
+	}
+	for i, col := range columns {
+		c.checks[i] = typeCheck(col.dbType)
+	}
+
+	return c
+}
+
+// typeCheck returns a function reporting if a value parses as dbType, nil if the type is
+// not checked
+func typeCheck(dbType string) func([]byte) bool {
+	unsigned := strings.HasPrefix(dbType, "UNSIGNED ")
+	switch strings.TrimPrefix(dbType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if unsigned {
+			return func(v []byte) bool {
+				_, err := strconv.ParseUint(string(v), 10, 64)
+				return err == nil
+			}
+		}
+		return func(v []byte) bool {
+			_, err := strconv.ParseInt(string(v), 10, 64)
+			return err == nil
+		}
+	case "DECIMAL", "FLOAT", "DOUBLE":
+		return func(v []byte) bool {
+			_, err := strconv.ParseFloat(string(v), 64)
+			return err == nil
+		}
+	case "DATE":
+		return func(v []byte) bool {
+			return zeroDate(v) || parses("2006-01-02", v)
+		}
+	case "DATETIME", "TIMESTAMP":
+		// -parse-time values are written in RFC 3339 format
+		return func(v []byte) bool {
+			return zeroDate(v) || parses("2006-01-02 15:04:05", v) || parses(time.RFC3339Nano, v)
+		}
+	case "TIME":
+		return func(v []byte) bool {
+			return mysqlTime.Match(v)
+		}
+	}
+
+	return nil
+}
+
+// zeroDate reports if v is MySQL's zero date, which time.Parse rejects
+func zeroDate(v []byte) bool {
+	return strings.HasPrefix(string(v), "0000-00-00")
+}
+
+// parses reports if v parses with layout, fractional seconds are always accepted
+func parses(layout string, v []byte) bool {
+	_, err := time.Parse(layout, string(v))
+	return err == nil
+}
+
+// check counts the values of record that do not parse, it returns true once the sample is full
+func (c *typeChecker) check(record []sql.RawBytes) bool {
+	for i, field := range record {
+		if field != nil && c.checks[i] != nil && !c.checks[i](field) {
+			if c.bad[i] == 0 {
+				c.examples[i] = append([]byte(nil), field...)
+			}
+			c.bad[i]++
+		}
+	}
+	c.rows++
+
+	return c.rows >= c.max
+}
+
+// report warns about each column with values that did not parse
+func (c *typeChecker) report() {
+	for i, col := range c.columns {
+		if c.bad[i] > 0 {
+			logger.Printf("Warning: column %s is declared %s but %d of the first %d values do not parse as one, e.g. %q\n", col.name, col.dbType, c.bad[i], c.rows, c.examples[i])
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+var typeCheckTests = []struct {
+	dbType string
+	value  string
+	ok     bool
+}{
+	{"INT", "-12", true},
+	{"INT", "12a", false},
+	{"UNSIGNED BIGINT", "18446744073709551615", true},
+	{"UNSIGNED INT", "-1", false},
+	{"DECIMAL", "10.25", true},
+	{"DOUBLE", "1e+30", true},
+	{"FLOAT", "n/a", false},
+	{"DATE", "2017-01-31", true},
+	{"DATE", "0000-00-00", true},
+	{"DATE", "31/01/2017", false},
+	{"DATETIME", "2017-01-31 15:04:05.123456", true},
+	{"TIMESTAMP", "2017-01-31T15:04:05Z", true},
+	{"DATETIME", "2017-01-31", false},
+	{"TIME", "-838:59:59", true},
+	{"TIME", "12:00:00.5", true},
+	{"TIME", "noon", false},
+}
+
+func TestTypeCheck(t *testing.T) {
+	for n, tt := range typeCheckTests {
+		check := typeCheck(tt.dbType)
+		if check == nil {
+			t.Errorf("#%d: %s is not checked", n, tt.dbType)
+			continue
+		}
+		if got := check([]byte(tt.value)); got != tt.ok {
+			t.Errorf("#%d: %s %q got=%v want=%v", n, tt.dbType, tt.value, got, tt.ok)
+		}
+	}
+
+	for _, dbType := range []string{"VARCHAR", "BLOB", "BIT", "TEXT"} {
+		if typeCheck(dbType) != nil {
+			t.Errorf("%s should not be checked", dbType)
+		}
+	}
+}
+
+func TestTypeChecker(t *testing.T) {
+	c := newTypeChecker([]column{{name: "id", dbType: "INT"}, {name: "name", dbType: "VARCHAR"}}, 2)
+	if c.check([]sql.RawBytes{[]byte("x1"), []byte("a")}) {
+		t.Error("sample full after 1 row")
+	}
+	if !c.check([]sql.RawBytes{nil, []byte("b")}) {
+		t.Error("sample not full after 2 rows")
+	}
+
+	if c.bad[0] != 1 || string(c.examples[0]) != "x1" || c.bad[1] != 0 {
+		t.Errorf("got bad=%v examples=%q", c.bad, c.examples)
+	}
+}
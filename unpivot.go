@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// An unpivoter turns each record into one record per measure column, holding the key columns
+// followed by the measure's column name and value
+type unpivoter struct {
+	keys     []int
+	measures []int
+	names    []sql.RawBytes
+	out      []sql.RawBytes
+}
+
+// parseUnpivot splits an -unpivot value such as keys=id,day;measures=clicks,views into its
+// key and measure column names. keys may be left out to write only the name & value columns.
+func parseUnpivot(spec string) (keys []string, measures []string, err error) {
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, nil, fmt.Errorf("-unpivot part %q is not keys=... or measures=...", part)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "keys":
+			keys = splitList(kv[1])
+		case "measures":
+			measures = splitList(kv[1])
+		default:
+			return nil, nil, fmt.Errorf("-unpivot part %q is not keys=... or measures=...", part)
+		}
+	}
+
+	if len(measures) == 0 {
+		return nil, nil, fmt.Errorf("-unpivot requires at least one measure column")
+	}
+
+	return keys, measures, nil
+}
+
+// newUnpivoter resolves the key and measure column names against the query's columns
+func newUnpivoter(cols []sql.RawBytes, keys []string, measures []string, caseSensitive bool) (*unpivoter, error) {
+	u := &unpivoter{}
+	used := make(map[int]bool)
+
+	resolve := func(name string) (int, error) {
+		for i, col := range cols {
+			if columnMatch(string(col), name, caseSensitive) {
+				if used[i] {
+					return 0, fmt.Errorf("-unpivot column %s is listed more than once", name)
+				}
+				used[i] = true
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("-unpivot column %s is not in the query results", name)
+	}
+
+	for _, name := range keys {
+		i, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		u.keys = append(u.keys, i)
+	}
+	for _, name := range measures {
+		i, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		u.measures = append(u.measures, i)
+		u.names = append(u.names, cols[i])
+	}
+
+	u.out = make([]sql.RawBytes, len(u.keys)+2)
+
+	return u, nil
+}
+
+// header returns the unpivoted column names
+func (u *unpivoter) header(cols []sql.RawBytes) []sql.RawBytes {
+	header := make([]sql.RawBytes, 0, len(u.keys)+2)
+	for _, k := range u.keys {
+		header = append(header, cols[k])
+	}
+
+	return append(header, []byte("metric_name"), []byte("metric_value"))
+}
+
+// columns returns the unpivoted column descriptions, the name & value columns are TEXT
+func (u *unpivoter) columns(columns []column) []column {
+	out := make([]column, 0, len(u.keys)+2)
+	for _, k := range u.keys {
+		out = append(out, columns[k])
+	}
+
+	return append(out, column{name: "metric_name", dbType: "TEXT"}, column{name: "metric_value", dbType: "TEXT"})
+}
+
+// record returns the unpivoted record for measure m of data. The returned slice is reused by
+// the next call.
+func (u *unpivoter) record(data []sql.RawBytes, m int) []sql.RawBytes {
+	for i, k := range u.keys {
+		u.out[i] = data[k]
+	}
+	u.out[len(u.keys)] = u.names[m]
+	u.out[len(u.keys)+1] = data[u.measures[m]]
+
+	return u.out
+}
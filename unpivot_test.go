@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestParseUnpivot(t *testing.T) {
+	keys, measures, err := parseUnpivot("keys=id, day;measures=clicks,views")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"id", "day"}) || !reflect.DeepEqual(measures, []string{"clicks", "views"}) {
+		t.Errorf("got keys=%q measures=%q", keys, measures)
+	}
+
+	for _, spec := range []string{"keys=id", "measures", "keys=id;values=a"} {
+		if _, _, err := parseUnpivot(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestUnpivot(t *testing.T) {
+	cols := []sql.RawBytes{[]byte("id"), []byte("Clicks"), []byte("day"), []byte("views")}
+	u, err := newUnpivoter(cols, []string{"id", "day"}, []string{"clicks", "views"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	want := []sql.RawBytes{[]byte("id"), []byte("day"), []byte("metric_name"), []byte("metric_value")}
+	if got := u.header(cols); !reflect.DeepEqual(got, want) {
+		t.Errorf("header got=%q want=%q", got, want)
+	}
+
+	data := []sql.RawBytes{[]byte("1"), []byte("10"), []byte("mon"), nil}
+	want = []sql.RawBytes{[]byte("1"), []byte("mon"), []byte("Clicks"), []byte("10")}
+	if got := u.record(data, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("record 0 got=%q want=%q", got, want)
+	}
+	want = []sql.RawBytes{[]byte("1"), []byte("mon"), []byte("views"), nil}
+	if got := u.record(data, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("record 1 got=%q want=%q", got, want)
+	}
+
+	if _, err := newUnpivoter(cols, []string{"id"}, []string{"missing"}, false); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if _, err := newUnpivoter(cols, []string{"id"}, []string{"id"}, false); err == nil {
+		t.Error("expected an error for a repeated column")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// verifyOutput re-reads a finished output file and makes sure it holds the expected
+// number of records. This catches truncation a successful flush and close may not surface.
+// Compressed output is decompressed as it is read, which also checks the gzip trailers.
+func (exi *exportInfo) verifyOutput(name string, rows uint) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if exi.compress != "none" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("verification failed: %s: %s", name, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var count uint
+	want := rows
+	if exi.format == "sql" {
+		count, err = countSQLRows(r)
+	} else {
+		count, err = countRecords(r, exi.terminator, exi.readEscape(), exi.quote)
+		if exi.header {
+			want++
+		}
+		if exi.countLine {
+			want++
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if count != want {
+		return fmt.Errorf("verification failed: %s contains %d records, expected %d", name, count, want)
+	}
+
+	return nil
+}
+
+// countRecords counts unescaped terminators outside of quotes in CSV output
+func countRecords(r io.Reader, terminator string, escape string, quote string) (uint, error) {
+	br := bufio.NewReader(r)
+	term := []byte(terminator)
+	window := make([]byte, 0, len(term))
+
+	var count uint
+	var escaped bool
+	var quoted bool
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		// The byte following an escape character is always part of a field
+		if escaped {
+			escaped = false
+			continue
+		}
+		if len(escape) == 1 && b == escape[0] {
+			escaped = true
+			window = window[:0]
+			continue
+		}
+
+		// Doubled quotes toggle twice and leave the field quoted
+		if len(quote) == 1 && b == quote[0] {
+			quoted = !quoted
+			window = window[:0]
+			continue
+		}
+		if quoted {
+			continue
+		}
+
+		if len(window) == len(term) {
+			window = append(window[:0], window[1:]...)
+		}
+		window = append(window, b)
+		if bytes.Equal(window, term) {
+			count++
+			window = window[:0]
+		}
+	}
+}
+
+// countSQLRows counts the rows in INSERT statements written by SQLWriter, every row
+// is written on its own line following the INSERT line of its statement
+func countSQLRows(r io.Reader) (uint, error) {
+	var lines, inserts uint
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	for scanner.Scan() {
+		lines++
+		if bytes.HasPrefix(scanner.Bytes(), []byte("INSERT INTO ")) {
+			inserts++
+		}
+	}
+
+	return lines - inserts, scanner.Err()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+var countTests = []struct {
+	Input       [][]sql.RawBytes
+	Terminator  string
+	DoubleQuote bool
+}{
+	{Input: [][]sql.RawBytes{{[]byte("abc")}, {[]byte("def")}}, Terminator: "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a\nb")}, {[]byte("c\\")}, {[]byte("\n")}}, Terminator: "\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a\r\nb")}, {[]byte("c\r")}, {nil}}, Terminator: "\r\n"},
+	{Input: [][]sql.RawBytes{{[]byte("a\x00b")}, {[]byte("c")}}, Terminator: "\x00"},
+	{Input: [][]sql.RawBytes{{[]byte("a|b")}, {[]byte("c")}}, Terminator: "|"},
+	{Input: [][]sql.RawBytes{{[]byte("a\nb")}, {[]byte(`c"\`)}, {nil}}, Terminator: "\n", DoubleQuote: true},
+}
+
+func TestCountRecords(t *testing.T) {
+	for n, tt := range countTests {
+		b := &bytes.Buffer{}
+		f := NewWriter(b)
+		f.Terminator = tt.Terminator
+		f.DoubleQuote = tt.DoubleQuote
+		f.WriteAll(tt.Input)
+
+		escape := "\\"
+		if tt.DoubleQuote {
+			escape = ""
+		}
+		got, err := countRecords(b, tt.Terminator, escape, "\"")
+		if err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+		if got != uint(len(tt.Input)) {
+			t.Errorf("#%d: got=%d want=%d", n, got, len(tt.Input))
+		}
+	}
+}
+
+func TestCountSQLRows(t *testing.T) {
+	b := &bytes.Buffer{}
+	f := NewSQLWriter(b)
+	f.Table = "t"
+	f.Batch = 2
+	for _, v := range []string{"1", "2\n", "3"} {
+		f.Write([]sql.RawBytes{[]byte(v)})
+	}
+	f.Close()
+
+	got, err := countSQLRows(strings.NewReader(b.String()))
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if got != 3 {
+		t.Errorf("got=%d want=%d", got, 3)
+	}
+}
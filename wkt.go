@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// WKB geometry type codes
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+)
+
+var errInvalidWKB = errors.New("invalid WKB geometry")
+
+// geometryToWKT converts a MySQL internal geometry value, a 4 byte SRID followed by WKB,
+// to WKT in the same form as MySQL's ST_AsText()
+func geometryToWKT(field []byte) ([]byte, error) {
+	if len(field) < 4 {
+		return nil, errInvalidWKB
+	}
+
+	r := &wkbReader{b: field[4:]}
+	out := r.geometry(nil, true)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) != 0 {
+		return nil, errInvalidWKB
+	}
+
+	return out, nil
+}
+
+// wkbReader decodes WKB geometries, the first error encountered is kept in err
+type wkbReader struct {
+	b     []byte
+	order binary.ByteOrder
+	err   error
+}
+
+// header reads the byte order and geometry type of a WKB geometry
+func (r *wkbReader) header() uint32 {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errInvalidWKB
+		return 0
+	}
+
+	switch r.b[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		r.err = errInvalidWKB
+		return 0
+	}
+	r.b = r.b[1:]
+
+	return r.uint32()
+}
+
+func (r *wkbReader) uint32() uint32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.err = errInvalidWKB
+		return 0
+	}
+	n := r.order.Uint32(r.b)
+	r.b = r.b[4:]
+
+	return n
+}
+
+// count reads a number of items, each at least size bytes long, guarding against corrupt counts
+func (r *wkbReader) count(size int) int {
+	n := r.uint32()
+	if r.err == nil && uint64(n)*uint64(size) > uint64(len(r.b)) {
+		r.err = errInvalidWKB
+		return 0
+	}
+
+	return int(n)
+}
+
+func (r *wkbReader) float() float64 {
+	if r.err != nil || len(r.b) < 8 {
+		r.err = errInvalidWKB
+		return 0
+	}
+	f := math.Float64frombits(r.order.Uint64(r.b))
+	r.b = r.b[8:]
+
+	return f
+}
+
+// point appends "x y"
+func (r *wkbReader) point(out []byte) []byte {
+	out = strconv.AppendFloat(out, r.float(), 'f', -1, 64)
+	out = append(out, ' ')
+	return strconv.AppendFloat(out, r.float(), 'f', -1, 64)
+}
+
+// points appends "x y,x y,..." wrapped in parentheses
+func (r *wkbReader) points(out []byte) []byte {
+	n := r.count(16)
+	if n == 0 {
+		return appendEmpty(out)
+	}
+	out = append(out, '(')
+	for i := 0; i < n && r.err == nil; i++ {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = r.point(out)
+	}
+
+	return append(out, ')')
+}
+
+// rings appends a list of point lists wrapped in parentheses
+func (r *wkbReader) rings(out []byte) []byte {
+	n := r.count(4)
+	if n == 0 {
+		return appendEmpty(out)
+	}
+	out = append(out, '(')
+	for i := 0; i < n && r.err == nil; i++ {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = r.points(out)
+	}
+
+	return append(out, ')')
+}
+
+// appendEmpty appends EMPTY for a geometry without points, separated by a space from its type name
+func appendEmpty(out []byte) []byte {
+	if len(out) > 0 && out[len(out)-1] != '(' && out[len(out)-1] != ',' {
+		out = append(out, ' ')
+	}
+
+	return append(out, "EMPTY"...)
+}
+
+// geometry appends a single WKB geometry as WKT, tagged includes the geometry type name
+func (r *wkbReader) geometry(out []byte, tagged bool) []byte {
+	typ := r.header()
+	if r.err != nil {
+		return out
+	}
+
+	var name string
+	var body func([]byte) []byte
+	switch typ {
+	case wkbPoint:
+		name = "POINT"
+		body = func(out []byte) []byte {
+			return append(r.point(append(out, '(')), ')')
+		}
+	case wkbLineString:
+		name = "LINESTRING"
+		body = r.points
+	case wkbPolygon:
+		name = "POLYGON"
+		body = r.rings
+	case wkbMultiPoint:
+		name = "MULTIPOINT"
+		body = r.members
+	case wkbMultiLineString:
+		name = "MULTILINESTRING"
+		body = r.members
+	case wkbMultiPolygon:
+		name = "MULTIPOLYGON"
+		body = r.members
+	case wkbGeometryCollection:
+		name = "GEOMETRYCOLLECTION"
+		body = func(out []byte) []byte {
+			return r.collection(out, true)
+		}
+	default:
+		r.err = errInvalidWKB
+		return out
+	}
+
+	if tagged {
+		out = append(out, name...)
+	}
+
+	return body(out)
+}
+
+// members appends the untagged member geometries of a multi geometry
+func (r *wkbReader) members(out []byte) []byte {
+	return r.collection(out, false)
+}
+
+// collection appends the member geometries of a multi geometry or geometry collection
+func (r *wkbReader) collection(out []byte, tagged bool) []byte {
+	n := r.count(5)
+	if r.err != nil {
+		return out
+	}
+	if n == 0 {
+		return appendEmpty(out)
+	}
+
+	out = append(out, '(')
+	for i := 0; i < n && r.err == nil; i++ {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = r.geometry(out, tagged)
+	}
+
+	return append(out, ')')
+}
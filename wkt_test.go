@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+// geometry builds a MySQL internal geometry value from an SRID and little endian WKB parts
+func geometry(parts ...interface{}) []byte {
+	b := []byte{0, 0, 0, 0}
+	for _, p := range parts {
+		switch v := p.(type) {
+		case int:
+			b = binary.LittleEndian.AppendUint32(b, uint32(v))
+		case float64:
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+		case byte:
+			b = append(b, v)
+		}
+	}
+
+	return b
+}
+
+var le = byte(1)
+
+var wktTests = []struct {
+	Input  []byte
+	Output string
+}{
+	{Input: geometry(le, wkbPoint, 1.0, 2.5), Output: "POINT(1 2.5)"},
+	{Input: geometry(le, wkbLineString, 2, 0.0, 0.0, 1.0, 1.0), Output: "LINESTRING(0 0,1 1)"},
+	{Input: geometry(le, wkbPolygon, 1, 4, 0.0, 0.0, 1.0, 0.0, 1.0, 1.0, 0.0, 0.0), Output: "POLYGON((0 0,1 0,1 1,0 0))"},
+	{Input: geometry(le, wkbMultiPoint, 2, le, wkbPoint, 0.0, 0.0, le, wkbPoint, -1.0, 1.0), Output: "MULTIPOINT((0 0),(-1 1))"},
+	{Input: geometry(le, wkbMultiLineString, 1, le, wkbLineString, 2, 0.0, 0.0, 1.0, 1.0), Output: "MULTILINESTRING((0 0,1 1))"},
+	{Input: geometry(le, wkbGeometryCollection, 2, le, wkbPoint, 1.0, 1.0, le, wkbLineString, 2, 0.0, 0.0, 1.0, 1.0), Output: "GEOMETRYCOLLECTION(POINT(1 1),LINESTRING(0 0,1 1))"},
+	{Input: geometry(le, wkbGeometryCollection, 0), Output: "GEOMETRYCOLLECTION EMPTY"},
+	{Input: geometry(le, wkbLineString, 0), Output: "LINESTRING EMPTY"},
+	{Input: geometry(le, wkbPolygon, 0), Output: "POLYGON EMPTY"},
+	{Input: geometry(le, wkbMultiPoint, 0), Output: "MULTIPOINT EMPTY"},
+	{Input: geometry(le, wkbMultiLineString, 2, le, wkbLineString, 0, le, wkbLineString, 2, 0.0, 0.0, 1.0, 1.0), Output: "MULTILINESTRING(EMPTY,(0 0,1 1))"},
+	{Input: geometry(le, wkbGeometryCollection, 1, le, wkbPolygon, 0), Output: "GEOMETRYCOLLECTION(POLYGON EMPTY)"},
+}
+
+func TestGeometryToWKT(t *testing.T) {
+	for n, tt := range wktTests {
+		got, err := geometryToWKT(tt.Input)
+		if err != nil {
+			t.Errorf("#%d: Unexpected error: %s\n", n, err)
+		}
+		if string(got) != tt.Output {
+			t.Errorf("#%d: got=%q want=%q", n, got, tt.Output)
+		}
+	}
+}
+
+func TestGeometryToWKTBigEndian(t *testing.T) {
+	// SRID 4326 POINT(1 2) with a big endian WKB body
+	b, _ := hex.DecodeString("e6100000" + "00" + "00000001" + "3ff0000000000000" + "4000000000000000")
+	got, err := geometryToWKT(b)
+	if err != nil {
+		t.Errorf("Unexpected error: %s\n", err)
+	}
+	if string(got) != "POINT(1 2)" {
+		t.Errorf("got=%q want=%q", got, "POINT(1 2)")
+	}
+}
+
+func TestGeometryToWKTInvalid(t *testing.T) {
+	invalid := [][]byte{
+		[]byte("abc"),
+		geometry(le, wkbPoint, 1.0),
+		geometry(le, 99),
+		geometry(le, wkbLineString, 1000000, 0.0, 0.0),
+		append(geometry(le, wkbPoint, 1.0, 1.0), 0),
+	}
+
+	for n, b := range invalid {
+		if _, err := geometryToWKT(b); err == nil {
+			t.Errorf("#%d: Error should not be nil", n)
+		}
+	}
+}